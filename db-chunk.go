@@ -0,0 +1,244 @@
+// process a table in chunks of primary key ranges
+package dbx
+
+import (
+	"reflect"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+	"fmt"
+)
+
+type chunkOptions struct {
+	sleep time.Duration
+	after interface{}
+}
+
+type ChunkOption func(*chunkOptions)
+
+// sleep d between chunks to throttle the load
+func ChunkSleep(d time.Duration) ChunkOption {
+	return func(opts *chunkOptions) {
+		opts.sleep = d
+	}
+}
+
+// start after the key, which is the last hi given to fn, to resume after a crash
+func ResumeAfter(key interface{}) ChunkOption {
+	return func(opts *chunkOptions) {
+		opts.after = key
+	}
+}
+
+// walk the rows matching the conditions in the ascending order of pkCol, fn is called with the
+// first and the last key of every chunk of at most chunkSize rows. The keys are read from the primary,
+// as int64 if pkCol is an integer column, or as string otherwise.
+//  eg. err := db.XStmt("user").Where(dbx.Eq("status", 0)).ChunkByID("id", 1000, func(lo, hi interface{}) error {
+//          _, err := db.XStmt("user").Where(dbx.Between("id", lo, hi), dbx.Eq("status", 0)).Set(dbx.SetValue("status", 1)).Update(nil)
+//          return err
+//      }, dbx.ChunkSleep(100*time.Millisecond))
+func (s *dbxStmt) ChunkByID(pkCol string, chunkSize int, fn func(lo, hi interface{}) error, options ...ChunkOption) error {
+	var integer *bool
+	return s.chunkByID(pkCol, chunkSize, options, func(p *dbxStmt) (interface{}, int, error) {
+		if integer == nil {
+			isInt, err := p.integerColumn(pkCol)
+			if err != nil {
+				return nil, 0, err
+			}
+			integer = &isInt
+		}
+		keys, err := p.SelectCols(pkCol).queryColumn(*integer)
+		if err != nil || len(keys) == 0 {
+			return nil, 0, err
+		}
+		hi := keys[len(keys)-1]
+		return hi, len(keys), fn(keys[0], hi)
+	})
+}
+
+// like ChunkByID, fn is called with the rows of every chunk, which are filled in the slice pointed by slicePtr.
+// The slice is reused, so it must not be kept after fn returns. The columns selected by SelectCols() must include pkCol.
+func (s *dbxStmt) ChunkRowsByID(pkCol string, chunkSize int, slicePtr interface{}, fn func(batch interface{}) error, options ...ChunkOption) error {
+	if _, err := sliceElem(slicePtr); err != nil {
+		return err
+	}
+	pkName := columnName(pkCol)
+	if !selects(s.selection, pkName) {
+		return fmt.Errorf("the key column %s is not selected by %q", pkCol, s.selection)
+	}
+	rows := reflect.ValueOf(slicePtr).Elem()
+	return s.chunkByID(pkCol, chunkSize, options, func(p *dbxStmt) (interface{}, int, error) {
+		rows.SetLen(0)
+		p.SelectCols(s.selection)
+		if err := p.List(slicePtr); err != nil || rows.Len() == 0 {
+			return nil, 0, err
+		}
+		last := rows.Index(rows.Len()-1)
+		if last.Kind() != reflect.Ptr {
+			last = last.Addr()
+		}
+		_, vals, err := s.engine.beanColumns(last.Interface(), []string{pkName}, false)
+		if err != nil {
+			return nil, 0, err
+		}
+		return vals[0], rows.Len(), fn(rows.Interface())
+	})
+}
+
+// chunk is called with the statement limited to the keys after the last one and run on the primary,
+// it returns the last key and the number of rows of the chunk.
+func (s *dbxStmt) chunkByID(pkCol string, chunkSize int, options []ChunkOption, chunk func(p *dbxStmt) (interface{}, int, error)) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("bad chunk size %d", chunkSize)
+	}
+	opts := &chunkOptions{}
+	for _, o := range options {
+		o(opts)
+	}
+
+	ctx := s.context()
+	after := opts.after
+	for i := 0; ; i++ {
+		if i > 0 {
+			if err := sleepContext(ctx, opts.sleep); err != nil {
+				return err
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		p := *s
+		p.opts, p.selection = nil, ""
+		p.conds = append([]Cond(nil), s.conds...)
+		if after != nil {
+			p.conds = append(p.conds, Gt(pkCol, after))
+		}
+		p.Asc(pkCol).Limit(chunkSize)
+
+		last, n, err := chunk(p.Primary())
+		if err != nil {
+			return err
+		}
+		if n < chunkSize {
+			return nil
+		}
+		if !keyAfter(last, after) {
+			// the same rows would be walked again and again
+			return fmt.Errorf("the key %v of column %s is not after the last one %v", last, pkCol, after)
+		}
+		after = last
+	}
+}
+
+// true if key is greater than prev, the keys which are not integers are only checked to be different
+func keyAfter(key, prev interface{}) bool {
+	k, p := reflect.ValueOf(key), reflect.ValueOf(prev)
+	isInt := func(v reflect.Value) bool { return v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64 }
+	isUint := func(v reflect.Value) bool { return v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64 }
+	switch {
+	case key == nil || prev == nil:
+		return key != nil
+	case isInt(k) && isInt(p):
+		return k.Int() > p.Int()
+	case isUint(k) && isUint(p):
+		return k.Uint() > p.Uint()
+	}
+	return fmt.Sprint(key) != fmt.Sprint(prev)
+}
+
+// "table.`col`" -> "col"
+func columnName(col string) string {
+	if pos := strings.LastIndex(col, "."); pos >= 0 {
+		col = col[pos+1:]
+	}
+	return strings.Trim(col, "`")
+}
+
+// true if the column is in the selection like "id,name", "user.*" or "u.id AS id"
+func selects(selection string, col string) bool {
+	if len(strings.TrimSpace(selection)) == 0 {
+		return true
+	}
+	for _, f := range strings.Split(selection, ",") {
+		f = strings.TrimSpace(f)
+		if pos := strings.LastIndexAny(f, " \t"); pos >= 0 {
+			// the alias
+			f = f[pos+1:]
+		}
+		if f == "*" || strings.HasSuffix(f, ".*") || strings.EqualFold(columnName(f), col) {
+			return true
+		}
+	}
+	return false
+}
+
+// true if the column is an integer one, by information_schema
+func (s *dbxStmt) integerColumn(col string) (bool, error) {
+	table := s.table
+	if pos := strings.LastIndex(col, "."); pos >= 0 {
+		table = col[:pos]
+	}
+	rows, err := s.queryStrings("SELECT DATA_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=? AND COLUMN_NAME=?",
+		[]interface{}{strings.Trim(table, "`"), columnName(col)})
+	if err != nil || len(rows) == 0 || len(rows[0]) == 0 {
+		return false, err
+	}
+	switch strings.ToLower(rows[0][0]) {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		return true, nil
+	}
+	return false, nil
+}
+
+// the values of the first column, as int64 (or uint64 if it's too large) if integer is true, or as string
+func (s *dbxStmt) queryColumn(integer bool) ([]interface{}, error) {
+	query, args, err := s.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.queryStrings(query, args)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		if !integer {
+			vals = append(vals, row[0])
+		} else if n, err := strconv.ParseInt(row[0], 10, 64); err == nil {
+			vals = append(vals, n)
+		} else if u, err := strconv.ParseUint(row[0], 10, 64); err == nil {
+			vals = append(vals, u)
+		} else {
+			return nil, fmt.Errorf("bad integer key %q", row[0])
+		}
+	}
+	return vals, nil
+}
+
+// run the query with the session, context and read routing of the statement
+func (s *dbxStmt) queryStrings(query string, args []interface{}) ([][]string, error) {
+	stmt := s.engine.SqlStmt(s.table, query, append(s.options(), SqlArgs(args...))...)
+	if err := stmt.engine.checkConn(); err != nil {
+		return nil, err
+	}
+	if stmt.engine.IsDryRun() {
+		return nil, stmt.engine.logDryRun(stmt.ToSQL())
+	}
+	sess := stmt.queryStmt.createQuerySession(map[string]interface{}{_sql:stmt})
+	rows, err := sess.QuerySliceString()
+	if err != nil {
+		return nil, stmt.wrapError("query", err)
+	}
+	return rows, nil
+}
+
+func (s *dbxStmt) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
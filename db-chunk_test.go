@@ -0,0 +1,150 @@
+package dbx
+
+import (
+	"database/sql/driver"
+	"testing"
+	"strings"
+	"context"
+	"time"
+)
+
+func TestChunkByID(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	s := db.XStmt("user").Where(Gt("age", 10)).Desc("name").Limit(5)
+	var queries []string
+	var args [][]interface{}
+	err := s.chunkByID("id", 10, []ChunkOption{ResumeAfter(int64(100)), ChunkSleep(time.Millisecond)}, func(p *dbxStmt) (interface{}, int, error) {
+		if !p.primary {
+			t.Fatalf("the chunks are expected to be read from the primary")
+		}
+		q, v, err := p.SelectCols("id").ToSQL()
+		if err != nil {
+			return nil, 0, err
+		}
+		queries = append(queries, q)
+		args = append(args, v)
+		if len(queries) < 3 {
+			return int64(100 + len(queries)*10), 10, nil
+		}
+		return int64(125), 5, nil
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(queries) != 3 {
+		t.Fatalf("3 chunks expected, got %d", len(queries))
+	}
+	checkSQL(t, "chunk", queries[1], args[1], nil, "SELECT id FROM user WHERE (`age` > ?) AND (`id` > ?) ORDER BY `id` ASC LIMIT 10", 10, 110)
+
+	db.DryRun()
+	fn := func(lo, hi interface{}) error {
+		t.Fatalf("nothing to process in dry-run mode")
+		return nil
+	}
+	if err = s.ChunkByID("id", 10, fn); err != nil {
+		t.Fatalf("%v", err)
+	}
+	var users []sqlTestUser
+	if err = s.ChunkRowsByID("id", 10, &users, func(batch interface{}) error { return fn(nil, nil) }); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err = s.ChunkByID("id", 0, fn); err == nil {
+		t.Fatalf("error expected for chunk size 0")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = db.XStmt("user").WithContext(ctx).ChunkByID("id", 10, fn); err != context.Canceled {
+		t.Fatalf("context.Canceled expected, got %v", err)
+	}
+}
+
+func TestChunkKeys(t *testing.T) {
+	dataType := "varchar"
+	var keys [][]string // the keys returned by every chunk query
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		if strings.Contains(query, "information_schema") {
+			return stubRowsOf("DATA_TYPE", []driver.Value{dataType})
+		}
+		if len(keys) == 0 {
+			return stubRowsOf("id")
+		}
+		r := stubRowsOf("id")
+		for _, k := range keys[0] {
+			r.rows = append(r.rows, []driver.Value{[]byte(k)})
+		}
+		keys = keys[1:]
+		return r
+	})
+
+	var got [][2]interface{}
+	fn := func(lo, hi interface{}) error {
+		got = append(got, [2]interface{}{lo, hi})
+		return nil
+	}
+
+	// the numeric-looking keys of a varchar column are kept as strings
+	keys = [][]string{{"007", "010"}, {"012"}}
+	if err := db.XStmt("user").ChunkByID("code", 2, fn); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(got) != 2 || got[0] != [2]interface{}{"007", "010"} || got[1] != [2]interface{}{"012", "012"} {
+		t.Fatalf("unexpected chunks %v", got)
+	}
+
+	// the keys of an integer column are int64
+	dataType, got = "bigint", nil
+	keys = [][]string{{"7", "10"}, {"12"}}
+	if err := db.XStmt("user").ChunkByID("id", 2, fn); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(got) != 2 || got[0] != [2]interface{}{int64(7), int64(10)} || got[1] != [2]interface{}{int64(12), int64(12)} {
+		t.Fatalf("unexpected chunks %v", got)
+	}
+	stmts := stub.Stmts()
+	if q := stmts[len(stmts)-1]; q != "SELECT id FROM user WHERE (`id` > ?) ORDER BY `id` ASC LIMIT 2" {
+		t.Fatalf("unexpected query %q", q)
+	}
+
+	// the key doesn't advance
+	keys = [][]string{{"7", "7"}, {"7", "7"}}
+	if err := db.XStmt("user").ChunkByID("id", 2, fn, ResumeAfter(int64(7))); err == nil {
+		t.Fatalf("error expected for a key not advancing")
+	}
+}
+
+func TestChunkRowsByID(t *testing.T) {
+	var listed [][]driver.Value
+	db, _ := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		r := stubRowsOf("id,name,age", listed...)
+		listed = nil
+		return r
+	})
+
+	var users []sqlTestUser
+	fn := func(batch interface{}) error { return nil }
+	if err := db.XStmt("user").SelectCols("name,age").ChunkRowsByID("id", 2, &users, fn); err == nil {
+		t.Fatalf("error expected if the key is not selected")
+	}
+	for _, selection := range []string{"", "*", "user.*", "id,name", "user.`id` AS id, name"} {
+		if err := db.XStmt("user").SelectCols(selection).ChunkRowsByID("id", 2, &users, fn); err != nil {
+			t.Fatalf("%q: %v", selection, err)
+		}
+	}
+
+	// the same rows again
+	row := []driver.Value{int64(7), "john", int64(20)}
+	listed = [][]driver.Value{row, row}
+	n := 0
+	err := db.XStmt("user").ChunkRowsByID("id", 2, &users, func(batch interface{}) error {
+		if n += 1; n == 1 {
+			listed = [][]driver.Value{row, row}
+		}
+		return nil
+	}, ResumeAfter(int64(7)))
+	if err == nil || n != 1 {
+		t.Fatalf("error expected for a key not advancing, got %v after %d chunks", err, n)
+	}
+}
@@ -3,6 +3,7 @@ package dbx
 
 import (
 	"strings"
+	"fmt"
 )
 
 func buildConds(cb condBuilder, conds []Cond) {
@@ -17,11 +18,12 @@ func (sess *xormSession) appendCond(q string, v ...interface{}) condBuilder {
 	return (*xormSession)(sess1)
 }
 
-// sqlBuilder, only used for updateSetStmt
+// sqlBuilder, used for updateSetStmt and sub-queries
 type sqlBuilder struct {
 	q *strings.Builder
 	v []interface{}
 	hasWhere bool
+	raw *sqlCond // the whole statement given by dbx.Sql(), like Session.Sql()
 }
 
 func newSqlBuilder() *sqlBuilder {
@@ -41,7 +43,7 @@ func (sb *sqlBuilder) appendCond(q string, v ...interface{}) condBuilder {
 		sb.q.WriteString(" AND ")
 	} else {
 		sb.hasWhere = true
-		sb.q.WriteString(" ")
+		sb.q.WriteString(" WHERE ")
 	}
 	sb.q.WriteString("(")
 	sb.q.WriteString(q)
@@ -76,8 +78,63 @@ func (sb *sqlBuilder) appendSets(sets []Set) {
 	}
 }
 
+func (sb *sqlBuilder) appendSelect(fields string, table string, joinedElems []joinedElem, conds []Cond, bys []by, l limit) {
+	if len(fields) == 0 {
+		fields = "*"
+	}
+	fmt.Fprintf(sb.q, "SELECT %s FROM %s", fields, table)
+	for _, e := range joinedElems {
+		fmt.Fprintf(sb.q, " %s JOIN %s ON %s", e.joinType, e.joinedTbl, e.joinCond)
+	}
+	buildConds(sb, conds)
+	sb.appendBys(bys)
+	if l != nil {
+		sb.q.WriteString(l.makeLimitClause())
+	}
+}
+
+func (sb *sqlBuilder) appendBys(bys []by) {
+	var groupBys, orderBys []string
+	for _, b := range bys {
+		c, isGroupBy := b.makeByClause()
+		if len(c) == 0 {
+			continue
+		}
+		if isGroupBy {
+			groupBys = append(groupBys, c)
+		} else {
+			orderBys = append(orderBys, c)
+		}
+	}
+	if len(groupBys) > 0 {
+		fmt.Fprintf(sb.q, " GROUP BY %s", strings.Join(groupBys, ","))
+	}
+	if len(orderBys) > 0 {
+		fmt.Fprintf(sb.q, " ORDER BY %s", strings.Join(orderBys, ","))
+	}
+}
+
 func (sb *sqlBuilder) toParams() []interface{} {
+	if sb.raw != nil {
+		return append([]interface{}{sb.raw.sql}, sb.raw.args...)
+	}
 	sb.v[0] = sb.q.String() // replace the SQL place holder
 	return sb.v
 }
 
+func (sb *sqlBuilder) toSQL() (string, []interface{}) {
+	if sb.raw != nil {
+		return sb.raw.sql, sb.raw.args
+	}
+	return sb.q.String(), sb.v[1:]
+}
+
+// the statements built by sqlBuilder except SELECT can't be replaced by dbx.Sql()
+func (sb *sqlBuilder) toWriteSQL() (string, []interface{}, error) {
+	if sb.raw != nil {
+		return "", nil, errSqlCond
+	}
+	query, args := sb.toSQL()
+	return query, args, nil
+}
+
@@ -18,7 +18,7 @@ func (c *andElemWrapper) makeCond(cb condBuilder) condBuilder {
     }
     return cb
 }
-func (c *andElemWrapper) mkAndElem() (string, []interface{}) { return "", nil }
+func (c *andElemWrapper) mkAndElem() (string, []interface{}) { return c.a.mkAndElem() }
 
 type dummyAndElem struct{}
 func (a *dummyAndElem) makeCond(cb condBuilder) condBuilder { return cb }
@@ -67,6 +67,18 @@ func makeInElem(field string, val []interface{}, prep string) (string, []interfa
 	res := &strings.Builder{}
 	backquote := getQuote(field)
 	fmt.Fprintf(res, "%s%s%s %s ", backquote, field, backquote, prep)
+	if len(val) == 1 {
+		if sub, ok := val[0].(*dbxStmt); ok {
+			q, v := sub.subquery()
+			if getOptions(sub.opts...).limit != nil {
+				// MySQL doesn't support LIMIT in IN subqueries, but does in derived tables
+				fmt.Fprintf(res, "(SELECT * FROM (%s) AS dbx_in)", q)
+			} else {
+				fmt.Fprintf(res, "(%s)", q)
+			}
+			return res.String(), v
+		}
+	}
 	for i, _ := range val {
 		if i == 0 {
 			fmt.Fprintf(res, "(?")
@@ -82,12 +94,13 @@ func makeInElem(field string, val []interface{}, prep string) (string, []interfa
 type onlyCond struct {
 	dummyAndElem
 	cond string
+	args []interface{}
 }
 func (e *onlyCond) mkAndElem() (string, []interface{}) {
 	if len(e.cond) == 0 {
 		return "", nil
 	}
-	return e.cond, nil
+	return e.cond, e.args
 }
 
 type eqCond struct {
@@ -100,6 +113,9 @@ func (e *eqCond) mkAndElem() (string, []interface{}) {
 		return "", nil
 	}
 	backquote := getQuote(e.field)
+	if isNullValue(e.val) {
+		return fmt.Sprintf("%s%s%s IS NULL", backquote, e.field, backquote), nil
+	}
 	return fmt.Sprintf("%s%s%s=?", backquote, e.field, backquote), []interface{}{e.val}
 }
 
@@ -132,6 +148,14 @@ func (e *opCond) mkAndElem() (string, []interface{}) {
 		return e.field, nil
 	}
 	backquote := getQuote(e.field)
+	if isNullValue(e.val) {
+		switch e.op {
+		case "=":
+			return fmt.Sprintf("%s%s%s IS NULL", backquote, e.field, backquote), nil
+		case "<>", "!=":
+			return fmt.Sprintf("%s%s%s IS NOT NULL", backquote, e.field, backquote), nil
+		}
+	}
 	return fmt.Sprintf("%s%s%s %s ?", backquote, e.field, backquote, e.op), []interface{}{e.val}
 }
 
@@ -200,14 +224,88 @@ func (i *notInCond) mkAndElem() (string, []interface{}) {
 	return makeInElem(i.field, i.val, "NOT IN")
 }
 
+type betweenCond struct {
+	dummyAndElem
+	field string
+	lo interface{}
+	hi interface{}
+	prep string
+}
+func (b *betweenCond) mkAndElem() (string, []interface{}) {
+	if len(b.field) == 0 {
+		return "", nil
+	}
+	backquote := getQuote(b.field)
+	return fmt.Sprintf("%s%s%s %s ? AND ?", backquote, b.field, backquote, b.prep), []interface{}{b.lo, b.hi}
+}
+
+type likeCond struct {
+	dummyAndElem
+	field string
+	pattern string
+	prep string
+}
+func (l *likeCond) mkAndElem() (string, []interface{}) {
+	if len(l.field) == 0 {
+		return "", nil
+	}
+	backquote := getQuote(l.field)
+	return fmt.Sprintf("%s%s%s %s ? ESCAPE '%c'", backquote, l.field, backquote, l.prep, likeEscapeChar), []interface{}{l.pattern}
+}
+
+const likeEscapeChar = '!'
+
+var likeEscaper = strings.NewReplacer(
+	string(likeEscapeChar), string(likeEscapeChar)+string(likeEscapeChar),
+	"%", string(likeEscapeChar)+"%",
+	"_", string(likeEscapeChar)+"_",
+)
+
+type nullCond struct {
+	dummyAndElem
+	field string
+	prep string
+}
+func (n *nullCond) mkAndElem() (string, []interface{}) {
+	if len(n.field) == 0 {
+		return "", nil
+	}
+	backquote := getQuote(n.field)
+	return fmt.Sprintf("%s%s%s %s", backquote, n.field, backquote, n.prep), nil
+}
+
+type existsCond struct {
+	dummyAndElem
+	stmt *dbxStmt
+	prep string
+}
+func (e *existsCond) mkAndElem() (string, []interface{}) {
+	if e.stmt == nil {
+		return "", nil
+	}
+	q, v := e.stmt.subquery()
+	return fmt.Sprintf("%s (%s)", e.prep, q), v
+}
+
+// marker of updating/deleting all rows
+type allRowsCond struct {}
+func (a *allRowsCond) makeCond(cb condBuilder) condBuilder { return cb }
+
 type sqlCond struct {
 	sql string
+	args []interface{}
 }
 func (s *sqlCond) makeCond(cb condBuilder) condBuilder {
-	if sess1, ok := cb.(*xormSession); ok {
-		return (*xormSession)((*Session)(sess1).Sql(s.sql))
+	switch b := cb.(type) {
+	case *xormSession:
+		return (*xormSession)((*Session)(b).Sql(s.sql, s.args...))
+	case *sqlBuilder:
+		// the whole statement, as the xorm session does
+		b.raw = s
+		return b
+	default:
+		return cb
 	}
-	return cb
 }
 
 func getQuote(fieldName string) (backquote string) {
@@ -224,6 +322,9 @@ type ascOrderBy struct {
 func (o *ascOrderBy) makeBy(sess *Session) *Session {
 	return sess.Asc(o.fields...)
 }
+func (o *ascOrderBy) makeByClause() (string, bool) {
+	return joinFields(o.fields, " ASC"), false
+}
 
 type descOrderBy struct {
 	fields []string
@@ -231,6 +332,9 @@ type descOrderBy struct {
 func (o *descOrderBy) makeBy(sess *Session) *Session {
 	return sess.Desc(o.fields...)
 }
+func (o *descOrderBy) makeByClause() (string, bool) {
+	return joinFields(o.fields, " DESC"), false
+}
 
 type groupBy struct {
 	field []string
@@ -238,6 +342,21 @@ type groupBy struct {
 func (o *groupBy) makeBy(sess *Session) *Session {
 	return sess.GroupBy(strings.Join(o.field, ","))
 }
+func (o *groupBy) makeByClause() (string, bool) {
+	return strings.Join(o.field, ","), true
+}
+
+func joinFields(fields []string, suffix string) string {
+	res := &strings.Builder{}
+	for i, f := range fields {
+		if i > 0 {
+			res.WriteString(",")
+		}
+		backquote := getQuote(f)
+		fmt.Fprintf(res, "%s%s%s%s", backquote, f, backquote, suffix)
+	}
+	return res.String()
+}
 
 // implementation of interface Limit
 type limitOffset struct {
@@ -250,3 +369,12 @@ func (l *limitOffset) makeLimit(sess *Session) *Session {
 	}
 	return sess
 }
+func (l *limitOffset) makeLimitClause() string {
+	if l.count <= 0 {
+		return ""
+	}
+	if l.offset > 0 {
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", l.count, l.offset)
+	}
+	return fmt.Sprintf(" LIMIT %d", l.count)
+}
@@ -1,6 +1,7 @@
 package dbx
 
 import (
+	"database/sql"
 	"testing"
 	"fmt"
 )
@@ -20,6 +21,178 @@ func TestConds(t *testing.T) {
 	printAndElem(Not(Or(Eq("name", "rosbit"), And(Eq("name", "rosbit"), Eq("age", 10)), Op("age", ">", 10))), "Not-Or-And")
 }
 
+func TestBetweenConds(t *testing.T) {
+	cases := []struct{
+		e AndElem
+		q string
+		v []interface{}
+	}{
+		{Between("age", 1, 10), "`age` BETWEEN ? AND ?", []interface{}{1, 10}},
+		{NotBetween("age", 1, 10), "`age` NOT BETWEEN ? AND ?", []interface{}{1, 10}},
+		{Between("user.age", 1, 10), "user.age BETWEEN ? AND ?", []interface{}{1, 10}},
+		{And(Eq("name", "rosbit"), NotBetween("age", 1, 10)), "(`name`=?) AND (`age` NOT BETWEEN ? AND ?)", []interface{}{"rosbit", 1, 10}},
+		{Not(NotBetween("age", 1, 10)), "NOT (`age` NOT BETWEEN ? AND ?)", []interface{}{1, 10}},
+		{Or(NotBetween("age", 1, 10), Eq("name", "john")), "(`age` NOT BETWEEN ? AND ?) OR (`name`=?)", []interface{}{1, 10, "john"}},
+		{Not(Or(Between("age", 1, 10), Eq("name", "john"))), "NOT ((`age` BETWEEN ? AND ?) OR (`name`=?))", []interface{}{1, 10, "john"}},
+	}
+	for _, c := range cases {
+		q, v := c.e.mkAndElem()
+		if q != c.q || fmt.Sprint(v) != fmt.Sprint(c.v) {
+			t.Fatalf("expected %q %v, got %q %v", c.q, c.v, q, v)
+		}
+	}
+}
+
+func TestLikeConds(t *testing.T) {
+	cases := []struct{
+		e AndElem
+		q string
+		v []interface{}
+	}{
+		{Like("name", "ros%"), "`name` LIKE ? ESCAPE '!'", []interface{}{"ros%"}},
+		{NotLike("name", "%bit"), "`name` NOT LIKE ? ESCAPE '!'", []interface{}{"%bit"}},
+		{Contains("name", "50%_off!"), "`name` LIKE ? ESCAPE '!'", []interface{}{"%50!%!_off!!%"}},
+		{HasPrefix("name", "r_"), "`name` LIKE ? ESCAPE '!'", []interface{}{"r!_%"}},
+		{HasSuffix("name", "%t"), "`name` LIKE ? ESCAPE '!'", []interface{}{"%!%t"}},
+		{Or(HasPrefix("name", "r_"), HasSuffix("name", "%t")), "(`name` LIKE ? ESCAPE '!') OR (`name` LIKE ? ESCAPE '!')", []interface{}{"r!_%", "%!%t"}},
+		{Not(NotLike("name", "%bit")), "NOT (`name` NOT LIKE ? ESCAPE '!')", []interface{}{"%bit"}},
+	}
+	for _, c := range cases {
+		q, v := c.e.mkAndElem()
+		if q != c.q || fmt.Sprint(v) != fmt.Sprint(c.v) {
+			t.Fatalf("expected %q %v, got %q %v", c.q, c.v, q, v)
+		}
+	}
+}
+
+func TestNullConds(t *testing.T) {
+	var nilPtr *int
+	one := 1
+	cases := []struct{
+		e AndElem
+		q string
+		n int
+	}{
+		{IsNull("deleted_at"), "`deleted_at` IS NULL", 0},
+		{IsNotNull("deleted_at"), "`deleted_at` IS NOT NULL", 0},
+		{Eq("deleted_at", nil), "`deleted_at` IS NULL", 0},
+		{Eq("age", nilPtr), "`age` IS NULL", 0},
+		{Eq("age", &one), "`age`=?", 1},
+		{Eq("name", sql.NullString{}), "`name` IS NULL", 0},
+		{Eq("name", sql.NullString{String:"rosbit", Valid:true}), "`name`=?", 1},
+		{Ne("deleted_at", nil), "`deleted_at` IS NOT NULL", 0},
+		{Ne("age", sql.NullInt64{}), "`age` IS NOT NULL", 0},
+		{Ne("age", 1), "`age` <> ?", 1},
+	}
+	for _, c := range cases {
+		q, v := c.e.mkAndElem()
+		if q != c.q || len(v) != c.n {
+			t.Fatalf("expected %q with %d args, got %q, %#v", c.q, c.n, q, v)
+		}
+	}
+}
+
+func TestSubqueryConds(t *testing.T) {
+	db := &DBI{}
+	vip := db.XStmt("vip").Cols("user_id").Where(Gt("level", 3)).Desc("level").Limit(10)
+	cases := []struct{
+		e AndElem
+		q string
+		v []interface{}
+	}{
+		{
+			In("user_id", vip),
+			"`user_id` IN (SELECT * FROM (SELECT user_id FROM vip WHERE (`level` > ?) ORDER BY `level` DESC LIMIT 10) AS dbx_in)",
+			[]interface{}{3},
+		},
+		{
+			NotIn("user_id", db.XStmt("vip").Cols("user_id").Where(Gt("level", 3))),
+			"`user_id` NOT IN (SELECT user_id FROM vip WHERE (`level` > ?))",
+			[]interface{}{3},
+		},
+		{
+			And(Eq("name", "rosbit"), NotIn("user_id", db.XStmt("ban").SelectCols("uid").Where(Eq("reason", "spam"))), Gt("age", 18)),
+			"(`name`=?) AND (`user_id` NOT IN (SELECT uid FROM ban WHERE (`reason`=?))) AND (`age` > ?)",
+			[]interface{}{"rosbit", "spam", 18},
+		},
+		{
+			Exists(db.XStmt("orders").Where(EqX("orders.user_id", "user.id"), In("status", 1, 2))),
+			"EXISTS (SELECT * FROM orders WHERE (orders.user_id=user.id) AND (`status` IN (?,?)))",
+			[]interface{}{1, 2},
+		},
+		{
+			NotExists(db.XStmt("orders").Where(EqX("orders.user_id", "user.id"))),
+			"NOT EXISTS (SELECT * FROM orders WHERE (orders.user_id=user.id))",
+			nil,
+		},
+	}
+	for _, c := range cases {
+		q, v := c.e.mkAndElem()
+		if q != c.q || fmt.Sprint(v) != fmt.Sprint(c.v) {
+			t.Fatalf("expected %q %v, got %q %v", c.q, c.v, q, v)
+		}
+	}
+}
+
+func TestSqlArgs(t *testing.T) {
+	type user struct {
+		UserId int
+		Name string
+	}
+	cases := []struct{
+		q string
+		args []interface{}
+		expectedQ string
+		expectedV []interface{}
+	}{
+		{"age>? AND name=?", []interface{}{10, "rosbit"}, "age>? AND name=?", []interface{}{10, "rosbit"}},
+		{"user_id=:user_id AND name=:name", []interface{}{Named(map[string]interface{}{"user_id":1, "name":"rosbit"})}, "user_id=? AND name=?", []interface{}{1, "rosbit"}},
+		{"user_id=:user_id OR :user_id=0", []interface{}{Named(&user{UserId:2})}, "user_id=? OR ?=0", []interface{}{2, 2}},
+		{"name=':name' AND t=a::date AND id=:id", []interface{}{Named(map[string]int{"id":3})}, "name=':name' AND t=a::date AND id=?", []interface{}{3}},
+		{"id=:unknown", []interface{}{Named(map[string]int{"id":3})}, "id=:unknown", nil},
+	}
+	for _, c := range cases {
+		q, v := bindArgs(c.q, c.args)
+		if q != c.expectedQ || fmt.Sprint(v) != fmt.Sprint(c.expectedV) {
+			t.Fatalf("expected %q %v, got %q %v", c.expectedQ, c.expectedV, q, v)
+		}
+	}
+
+	sb := newSqlBuilder()
+	sb.q.WriteString("UPDATE user SET `age`=?")
+	sb.v = append(sb.v, 10)
+	buildConds(sb, Where(Eq("name", "rosbit"), OnlyCond("age<:age", Named(map[string]int{"age":10})), OnlyCond("id>?", 1)))
+	q, v := sb.toSQL()
+	if expected := "UPDATE user SET `age`=? WHERE (`name`=?) AND (age<?) AND (id>?)"; q != expected || fmt.Sprint(v) != fmt.Sprint([]interface{}{10, "rosbit", 10, 1}) {
+		t.Fatalf("unexpected %q %v", q, v)
+	}
+
+	// dbx.Sql() is the whole statement
+	sb = newSqlBuilder()
+	sb.appendSelect("", "user", nil, Where(Eq("name", "rosbit"), Sql("select id,name from user where age<:age", Named(map[string]int{"age":10}))), nil, nil)
+	q, v = sb.toSQL()
+	if expected := "select id,name from user where age<?"; q != expected || fmt.Sprint(v) != fmt.Sprint([]interface{}{10}) {
+		t.Fatalf("unexpected %q %v", q, v)
+	}
+	if _, _, err := sb.toWriteSQL(); err != errSqlCond {
+		t.Fatalf("errSqlCond expected, got %v", err)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	cases := map[string]string{
+		"rosbit": "rosbit",
+		"50%": "50!%",
+		"a_b": "a!_b",
+		"wow!": "wow!!",
+	}
+	for in, expected := range cases {
+		if out := EscapeLike(in); out != expected {
+			t.Fatalf("EscapeLike(%q): expected %q, got %q", in, expected, out)
+		}
+	}
+}
+
 func printAndElem(e AndElem, prompt string) {
 	q, v := e.mkAndElem()
 	fmt.Printf("%s: %s, %#v\n", prompt, q, v)
@@ -3,11 +3,80 @@ package dbx
 
 import (
 	"github.com/rosbit/xorm"
+	"database/sql"
+	"context"
+	"fmt"
 	"runtime"
+	"sync"
+	"time"
 )
 
 type DBI struct {
 	*xorm.Engine
+	dryRun int32 // 1 if dry-run is on, accessed atomically
+	safeWrites bool
+	err error // set if the DBI is a placeholder of a missing connection
+	mu sync.RWMutex // guards replicas, which is cleared by Close()
+	replicas *replicaSet
+	rywWindow time.Duration
+	catchUp CatchUpChecker
+}
+
+type dbOptions struct {
+	debug bool
+	safeWrites bool
+	maxOpenConns int
+	maxIdleConns *int // nil if not set, the default of database/sql is kept
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+	replicas []string
+	readPolicy ReplicaPolicy
+	healthCheckInterval time.Duration
+	rywWindow time.Duration
+	catchUp CatchUpChecker
+}
+
+type DBOption func(*dbOptions)
+
+// show SQL
+func Debug(debug bool) DBOption {
+	return func(opts *dbOptions) {
+		opts.debug = debug
+	}
+}
+
+// <= 0 means unlimited
+func MaxOpenConns(n int) DBOption {
+	return func(opts *dbOptions) {
+		opts.maxOpenConns = n
+	}
+}
+
+// <= 0 means no idle connections are retained
+func MaxIdleConns(n int) DBOption {
+	return func(opts *dbOptions) {
+		opts.maxIdleConns = &n
+	}
+}
+
+func ConnMaxLifetime(d time.Duration) DBOption {
+	return func(opts *dbOptions) {
+		opts.connMaxLifetime = d
+	}
+}
+
+func ConnMaxIdleTime(d time.Duration) DBOption {
+	return func(opts *dbOptions) {
+		opts.connMaxIdleTime = d
+	}
+}
+
+// UPDATE/DELETE without WHERE are rejected with ErrUnsafeStatement if safe is true, which is the default.
+// use Where(dbx.AllRows()) to update/delete all rows explicitly.
+func SafeWrites(safe bool) DBOption {
+	return func(opts *dbOptions) {
+		opts.safeWrites = safe
+	}
 }
 
 var (
@@ -15,45 +84,132 @@ var (
 )
 
 // create a default instatnce of db connection for a driver
-func CreateDBDriverConnection(driverName, dsn string, debug bool) (err error) {
-	DB, err = CreateDriverDBInstance(driverName, dsn, debug)
+func CreateDBDriverConnection(driverName, dsn string, options ...DBOption) (err error) {
+	var db *DBI
+	if db, err = CreateDriverDBInstance(driverName, dsn, options...); err != nil {
+		return
+	}
+	registryLock.Lock()
+	DB = db
+	registryLock.Unlock()
 	return
 }
 
+// a placeholder carrying ErrNoConnection is returned if there's no default connection,
+// so that the statements return the error instead of panicking.
 func getDefaultConnection() *DBI {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
 	if DB == nil {
-		panic("please call CreateDBConnection(...) first")
+		return &DBI{err: fmt.Errorf("%w: please call CreateMysqlConnection(...)/CreateDBDriverConnection(...), or register one of CreateDriverDBInstance(...) with dbx.Register(...) first", ErrNoConnection)}
 	}
 	return DB
 }
 
+func (db *DBI) checkConn() error {
+	if db == nil {
+		return ErrNoConnection
+	}
+	if db.err != nil {
+		return db.err
+	}
+	if db.Engine == nil {
+		return ErrNoConnection
+	}
+	return nil
+}
+
 // create an instance of connection for a driver
-func CreateDriverDBInstance(driverName, dsn string, debug bool) (db *DBI, err error) {
+//  eg. CreateDriverDBInstance("mysql", dsn, dbx.MaxOpenConns(50), dbx.ConnMaxLifetime(time.Minute), dbx.Debug(true))
+func CreateDriverDBInstance(driverName, dsn string, options ...DBOption) (db *DBI, err error) {
+	opts := &dbOptions{safeWrites: true, healthCheckInterval: defaultHealthCheckInterval}
+	for _, o := range options {
+		o(opts)
+	}
+
 	var dbInst *xorm.Engine
 	dbInst, err = xorm.NewEngine(driverName, dsn)
 	if err == nil {
-		db = &DBI{dbInst}
-		if debug {
+		db = &DBI{Engine: dbInst, safeWrites: opts.safeWrites, rywWindow: opts.rywWindow, catchUp: opts.catchUp}
+		if opts.debug {
 			dbInst.ShowSQL(true)
 		}
+		setPool(dbInst, opts)
+		if len(opts.replicas) > 0 {
+			if db.replicas, err = newReplicaSet(driverName, opts); err != nil {
+				dbInst.Close()
+				return nil, err
+			}
+		}
 		runtime.SetFinalizer(db, freeDBI)
 	}
 	return
 }
 
-func Close() error {
-	if DB == nil {
-		return nil
+func setPool(engine *xorm.Engine, opts *dbOptions) {
+	sqlDB := engine.DB().DB
+	if opts.maxOpenConns != 0 {
+		sqlDB.SetMaxOpenConns(opts.maxOpenConns)
+	}
+	if opts.maxIdleConns != nil {
+		sqlDB.SetMaxIdleConns(*opts.maxIdleConns)
+	}
+	if opts.connMaxLifetime != 0 {
+		sqlDB.SetConnMaxLifetime(opts.connMaxLifetime)
+	}
+	if opts.connMaxIdleTime != 0 {
+		sqlDB.SetConnMaxIdleTime(opts.connMaxIdleTime)
+	}
+}
+
+// statistics of the connection pool, all zero if there's no connection
+func (db *DBI) PoolStats() sql.DBStats {
+	if db.checkConn() != nil {
+		return sql.DBStats{}
 	}
+	return db.Engine.DB().Stats()
+}
 
-	defer func() {
-		DB = nil
-	}()
+func (db *DBI) Ping() error {
+	if err := db.checkConn(); err != nil {
+		return err
+	}
+	return db.Engine.Ping()
+}
 
-	return DB.Close()
+func (db *DBI) PingContext(ctx context.Context) error {
+	if err := db.checkConn(); err != nil {
+		return err
+	}
+	return db.Engine.PingContext(ctx)
+}
+
+func Close() error {
+	registryLock.Lock()
+	db := DB
+	DB = nil
+	registryLock.Unlock()
+
+	if db == nil {
+		return nil
+	}
+	return db.Close()
 }
 
 func (db *DBI) Close() (err error) {
+	if db == nil {
+		return ErrNoConnection
+	}
+	if db.err != nil {
+		// a placeholder of Use() or getDefaultConnection()
+		return db.err
+	}
+	db.mu.Lock()
+	if db.replicas != nil {
+		db.replicas.close()
+		db.replicas = nil
+	}
+	db.mu.Unlock()
 	if db.Engine != nil {
 		err = db.Engine.Close()
 		db.Engine = nil
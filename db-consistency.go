@@ -0,0 +1,249 @@
+// read-your-writes when reads go to replicas
+package dbx
+
+import (
+	"github.com/rosbit/xorm"
+	"encoding/base64"
+	"crypto/sha256"
+	"crypto/hmac"
+	"context"
+	"strconv"
+	"strings"
+	"errors"
+	"sync"
+	"time"
+)
+
+// a consistency token remembers the last write in a context. Reads with the token go to the primary
+// within the window given by ReadYourWrites(), or until a replica has caught up with the write.
+// It can be sent to the client with String() and restored with ParseConsistencyToken() in the next request.
+type ConsistencyToken struct {
+	mu sync.Mutex
+	written time.Time
+	pos string // the position of the write given by CatchUpChecker
+}
+
+type consistencyKey struct{}
+
+// ctx carrying a consistency token, a new one is created if token is not given
+//  eg. ctx := dbx.WithConsistency(r.Context())
+//      db.XStmt("user").WithContext(ctx).Update(&user)
+//      db.XStmt("user").WithContext(ctx).Get(&user)  // read from the primary
+func WithConsistency(ctx context.Context, token ...*ConsistencyToken) context.Context {
+	var t *ConsistencyToken
+	if len(token) > 0 && token[0] != nil {
+		t = token[0]
+	} else {
+		t = &ConsistencyToken{}
+	}
+	return context.WithValue(ctx, consistencyKey{}, t)
+}
+
+// nil if there's no token in ctx
+func ConsistencyFromContext(ctx context.Context) *ConsistencyToken {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(consistencyKey{}).(*ConsistencyToken)
+	return t
+}
+
+var (
+	errBadToken = errors.New("bad consistency token")
+
+	tokenKeyLock = &sync.RWMutex{}
+	tokenKey []byte
+)
+
+// the clocks of the servers sharing tokens may differ by this at most
+const maxTokenSkew = time.Second
+
+// tokens are signed with key by String(), and the ones not signed with it are rejected by ParseConsistencyToken().
+// It should be set if tokens are sent to the clients, otherwise a forged token can keep the reads on the primary.
+func SetConsistencyKey(key []byte) {
+	tokenKeyLock.Lock()
+	tokenKey = append([]byte(nil), key...)
+	tokenKeyLock.Unlock()
+}
+
+func tokenMAC(payload []byte) []byte {
+	tokenKeyLock.RLock()
+	defer tokenKeyLock.RUnlock()
+	if len(tokenKey) == 0 {
+		return nil
+	}
+	mac := hmac.New(sha256.New, tokenKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (t *ConsistencyToken) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.written.IsZero() {
+		return ""
+	}
+	payload := []byte(strconv.FormatInt(t.written.UnixNano(), 10) + "|" + t.pos)
+	s := base64.RawURLEncoding.EncodeToString(payload)
+	if mac := tokenMAC(payload); mac != nil {
+		s += "." + base64.RawURLEncoding.EncodeToString(mac)
+	}
+	return s
+}
+
+// the token generated by String(). The signature is checked if SetConsistencyKey() is called,
+// and a token written in the future is rejected.
+func ParseConsistencyToken(s string) (*ConsistencyToken, error) {
+	if len(s) == 0 {
+		return &ConsistencyToken{}, nil
+	}
+	parts := strings.SplitN(s, ".", 2)
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errBadToken
+	}
+	if mac := tokenMAC(payload); mac != nil {
+		if len(parts) != 2 {
+			return nil, errBadToken
+		}
+		sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil || !hmac.Equal(sig, mac) {
+			return nil, errBadToken
+		}
+	}
+	fields := strings.SplitN(string(payload), "|", 2)
+	if len(fields) != 2 {
+		return nil, errBadToken
+	}
+	ns, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || ns <= 0 {
+		return nil, errBadToken
+	}
+	written := time.Unix(0, ns)
+	if written.After(time.Now().Add(maxTokenSkew)) {
+		return nil, errBadToken
+	}
+	return &ConsistencyToken{written: written, pos: fields[1]}, nil
+}
+
+func (t *ConsistencyToken) wrote(pos string) {
+	t.mu.Lock()
+	t.written, t.pos = time.Now(), pos
+	t.mu.Unlock()
+}
+
+func (t *ConsistencyToken) lastWrite() (time.Time, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.written, t.pos
+}
+
+// tells whether a replica has caught up with a write
+type CatchUpChecker interface {
+	// the position of the primary after a write
+	Position(primary *xorm.Engine) (string, error)
+	// true if the replica has reached the position
+	Reached(replica *xorm.Engine, pos string) (bool, error)
+}
+
+// reads in a context with a consistency token go to the primary within window after a write in the same context,
+// or until the replica has caught up with the write if checker is given.
+func ReadYourWrites(window time.Duration, checker ...CatchUpChecker) DBOption {
+	return func(opts *dbOptions) {
+		opts.rywWindow = window
+		if len(checker) > 0 {
+			opts.catchUp = checker[0]
+		}
+	}
+}
+
+// the position is @@GLOBAL.gtid_executed, GTID must be enabled
+func GTIDCatchUp() CatchUpChecker {
+	return gtidCatchUp{}
+}
+
+type gtidCatchUp struct{}
+
+func (gtidCatchUp) Position(primary *xorm.Engine) (string, error) {
+	return queryOne(primary, "SELECT @@GLOBAL.gtid_executed")
+}
+
+func (gtidCatchUp) Reached(replica *xorm.Engine, pos string) (bool, error) {
+	r, err := queryOne(replica, "SELECT GTID_SUBSET(?, @@GLOBAL.gtid_executed)", pos)
+	return r == "1", err
+}
+
+// the position is the time of the primary, and a replica has caught up if the heartbeat table
+// (updated by pt-heartbeat, for example) has a newer timestamp.
+func HeartbeatCatchUp(table, tsColumn string) CatchUpChecker {
+	return &heartbeatCatchUp{table: table, tsColumn: tsColumn}
+}
+
+type heartbeatCatchUp struct {
+	table string
+	tsColumn string
+}
+
+func (h *heartbeatCatchUp) Position(primary *xorm.Engine) (string, error) {
+	return queryOne(primary, "SELECT CURRENT_TIMESTAMP(6)")
+}
+
+func (h *heartbeatCatchUp) Reached(replica *xorm.Engine, pos string) (bool, error) {
+	r, err := queryOne(replica, "SELECT COUNT(*) FROM " + h.table + " WHERE " + h.tsColumn + " >= ?", pos)
+	return len(r) > 0 && r != "0", err
+}
+
+func queryOne(engine *xorm.Engine, query string, args ...interface{}) (string, error) {
+	sess := engine.NewSession()
+	defer sess.Close()
+	rows, err := sess.QuerySliceString(append([]interface{}{query}, args...)...)
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return "", nil
+	}
+	return rows[0][0], nil
+}
+
+// remember the write in the consistency token of ctx
+func (db *DBI) markWrite(ctx context.Context) {
+	if db.rywWindow <= 0 || !db.hasReplicas() {
+		return
+	}
+	t := ConsistencyFromContext(ctx)
+	if t == nil {
+		return
+	}
+	var pos string
+	if db.catchUp != nil {
+		// the replicas are never trusted to catch up in the window if the position is unknown
+		pos, _ = db.catchUp.Position(db.Engine)
+	}
+	t.wrote(pos)
+}
+
+// true if the read must go to the primary, replica is the one to read otherwise
+func (db *DBI) mustReadPrimary(ctx context.Context, replica *xorm.Engine) bool {
+	if db.rywWindow <= 0 {
+		return false
+	}
+	t := ConsistencyFromContext(ctx)
+	if t == nil {
+		return false
+	}
+	written, pos := t.lastWrite()
+	if written.IsZero() {
+		return false
+	}
+	since := time.Since(written)
+	if since < -maxTokenSkew || since >= db.rywWindow {
+		// a token written in the future is not trusted
+		return false
+	}
+	if db.catchUp == nil || len(pos) == 0 {
+		return true
+	}
+	reached, err := db.catchUp.Reached(replica, pos)
+	return err != nil || !reached
+}
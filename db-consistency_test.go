@@ -0,0 +1,135 @@
+package dbx
+
+import (
+	"database/sql/driver"
+	"testing"
+	"strings"
+	"context"
+	"time"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	db, err := CreateMysqlInstance(GenerateMysqlDSN(DBName("test")),
+		Replicas(GenerateMysqlDSN(DBName("r1"))),
+		HealthCheckInterval(0),
+		ReadYourWrites(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer db.Close()
+	replica := db.replicas.replicas[0].engine
+
+	ctx := WithConsistency(context.Background())
+	if e := db.readEngine(ctx); e != replica {
+		t.Fatalf("the replica expected before any write")
+	}
+	db.markWrite(ctx)
+	if e := db.readEngine(ctx); e != db.Engine {
+		t.Fatalf("the primary expected after a write")
+	}
+	if e := db.readEngine(context.Background()); e != replica {
+		t.Fatalf("the replica expected without the token")
+	}
+
+	// the token spans requests
+	token, err := ParseConsistencyToken(ConsistencyFromContext(ctx).String())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if e := db.readEngine(WithConsistency(context.Background(), token)); e != db.Engine {
+		t.Fatalf("the primary expected with the restored token")
+	}
+	if _, err := ParseConsistencyToken("bad token"); err == nil {
+		t.Fatalf("error expected for a bad token")
+	}
+
+	// a token from the future would keep the reads on the primary forever
+	future := &ConsistencyToken{written: time.Now().Add(time.Hour)}
+	if _, err := ParseConsistencyToken(future.String()); err == nil {
+		t.Fatalf("error expected for a token from the future")
+	}
+	if e := db.readEngine(WithConsistency(context.Background(), future)); e != replica {
+		t.Fatalf("the replica expected with a token from the future")
+	}
+
+	time.Sleep(60*time.Millisecond)
+	if e := db.readEngine(ctx); e != replica {
+		t.Fatalf("the replica expected after the window")
+	}
+}
+
+func TestSignedConsistencyToken(t *testing.T) {
+	unsigned := (&ConsistencyToken{written: time.Now()}).String()
+
+	SetConsistencyKey([]byte("secret"))
+	defer SetConsistencyKey(nil)
+
+	token := &ConsistencyToken{written: time.Now(), pos: "uuid:1-5"}
+	s := token.String()
+	parsed, err := ParseConsistencyToken(s)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if written, pos := parsed.lastWrite(); !written.Equal(token.written) || pos != "uuid:1-5" {
+		t.Fatalf("unexpected token %v %s", written, pos)
+	}
+
+	forged := (&ConsistencyToken{written: time.Now(), pos: "uuid:1-9"}).String()
+	for _, bad := range []string{unsigned, s[:strings.Index(s, ".")] + forged[strings.Index(forged, "."):], s + "x"} {
+		if _, err := ParseConsistencyToken(bad); err == nil {
+			t.Fatalf("error expected for %q", bad)
+		}
+	}
+}
+
+func TestReadYourWritesStub(t *testing.T) {
+	rows := func(query string, args []driver.Value) stubResult {
+		if strings.HasPrefix(query, "SELECT") {
+			return stubRowsOf("id,name,age", []driver.Value{int64(1), "john", int64(10)})
+		}
+		return stubResult{affected: 1}
+	}
+	replicaDSN, replica := newStubDSN(t, rows)
+	db, primary := newStubDB(t, rows, Replicas(replicaDSN), HealthCheckInterval(0), ReadYourWrites(100*time.Millisecond))
+
+	const query = "SELECT `id`, `name`, `age` FROM `user` WHERE (`id`=?) LIMIT 1"
+	get := func(ctx context.Context) {
+		var user sqlTestUser
+		if has, err := db.XStmt("user").WithContext(ctx).Where(Eq("id", 1)).Get(&user); err != nil || !has {
+			t.Fatalf("a user expected, got %v", err)
+		}
+	}
+	last := func(stub *stubDB) string {
+		stmts := stub.Stmts()
+		if len(stmts) == 0 {
+			return ""
+		}
+		return stmts[len(stmts)-1]
+	}
+
+	ctx := WithConsistency(context.Background())
+	get(ctx)
+	if last(replica) != query || len(primary.Stmts()) != 0 {
+		t.Fatalf("the replica expected before any write, got %q, %q", replica.Stmts(), primary.Stmts())
+	}
+
+	if _, err := db.XStmt("user").WithContext(ctx).Set(SetExpr("age", "age+1")).Where(Eq("id", 1)).Update(nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+	get(ctx)
+	if stmts := primary.Stmts(); len(stmts) != 2 || stmts[1] != query {
+		t.Fatalf("the primary expected within the window, got %q", stmts)
+	}
+	n := len(replica.Stmts())
+	get(context.Background())
+	if len(replica.Stmts()) != n+1 {
+		t.Fatalf("the replica expected without the token, got %q", replica.Stmts())
+	}
+
+	time.Sleep(150*time.Millisecond)
+	get(ctx)
+	if len(replica.Stmts()) != n+2 || len(primary.Stmts()) != 2 {
+		t.Fatalf("the replica expected after the window, got %q, %q", replica.Stmts(), primary.Stmts())
+	}
+}
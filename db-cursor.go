@@ -0,0 +1,404 @@
+// cursor of result sets
+package dbx
+
+import (
+	"github.com/rosbit/xorm"
+	"xorm.io/core"
+	"database/sql"
+	"encoding/json"
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"sync"
+	"fmt"
+)
+
+// a forward-only cursor of a result set. The rows are closed when the end is reached,
+// an error occurs, or Close() is called, so it's safe to break the loop after calling Close().
+//  eg. c := db.XStmt("user").Where(dbx.Gt("age", 10)).Cursor(&user)
+//      defer c.Close()
+//      for c.Next() {
+//          // user is filled with the current row
+//      }
+//      if err := c.Err(); err != nil {
+//          ...
+//      }
+type Rows struct {
+	ctx  context.Context
+	stmt *execStmt
+	sess *Session // closed with the rows if it's not the session of a transaction
+	rows *core.Rows
+	loaded [][]interface{} // the rows of a transaction
+	cols []string
+	bean interface{}
+
+	mu  sync.Mutex
+	err error
+
+	closeRows sync.Once
+	stop      sync.Once
+	done      chan struct{} // closed by Close()
+	stopped   chan struct{} // closed when the goroutine of Chan() exits
+}
+
+// the rows are queried with the db of the session, and scanned into beans by the columns mapped by xorm.
+// xorm doesn't expose the transaction of a session, so the rows of a transaction are loaded by the session.
+func newRows(stmt *execStmt, sess *Session, bean interface{}, query string, args []interface{}) *Rows {
+	c := &Rows{ctx: stmt.context(), stmt: stmt, bean: bean, done: make(chan struct{})}
+	if logger := stmt.engine.Logger(); logger.IsShowSQL() {
+		logger.Infof("[SQL] %s %#v", query, args)
+	}
+	if stmt.session != nil {
+		res, err := sess.SQL(query, args...).QueryInterface()
+		if err != nil {
+			c.setErr(err)
+			return c
+		}
+		for _, row := range res {
+			if c.cols == nil {
+				for col, _ := range row {
+					c.cols = append(c.cols, col)
+				}
+			}
+			vals := make([]interface{}, len(c.cols))
+			for i, col := range c.cols {
+				vals[i] = row[col]
+			}
+			c.loaded = append(c.loaded, vals)
+		}
+		return c
+	}
+
+	c.sess = sess
+	rows, err := sess.DB().QueryContext(c.ctx, query, args...)
+	if err != nil {
+		c.setErr(err)
+		c.release()
+		return c
+	}
+	c.rows = rows
+	if c.cols, err = rows.Columns(); err != nil {
+		c.setErr(err)
+		c.release()
+	}
+	return c
+}
+
+// a cursor with nothing to iterate, err is returned by Err()
+func errRows(err error) *Rows {
+	c := &Rows{ctx: context.Background(), done: make(chan struct{})}
+	c.setErr(err)
+	return c
+}
+
+// move to the next row and fill the bean given by Cursor(), false is returned at the end or if an error occurs.
+func (c *Rows) Next() bool {
+	return c.next(c.bean)
+}
+
+func (c *Rows) next(bean interface{}) bool {
+	if c.stmt == nil || c.Err() != nil {
+		return false
+	}
+	if err := c.ctx.Err(); err != nil {
+		c.setErr(err)
+		c.release()
+		return false
+	}
+	vals, ok := c.fetch()
+	if !ok {
+		c.release()
+		return false
+	}
+	resetBean(bean)
+	if err := c.stmt.engine.scanBean(bean, c.cols, vals); err != nil {
+		c.setErr(err)
+		c.release()
+		return false
+	}
+	return true
+}
+
+// the values of the next row, false at the end or if an error occurs
+func (c *Rows) fetch() ([]interface{}, bool) {
+	if c.rows == nil {
+		if len(c.loaded) == 0 {
+			return nil, false
+		}
+		vals := c.loaded[0]
+		c.loaded = c.loaded[1:]
+		return vals, true
+	}
+	if !c.rows.Next() {
+		if err := c.rows.Err(); err != nil {
+			// the connection is lost or the server fails in the middle of the rows
+			c.setErr(err)
+		}
+		return nil, false
+	}
+	vals := make([]interface{}, len(c.cols))
+	ptrs := make([]interface{}, len(c.cols))
+	for i, _ := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := c.rows.Scan(ptrs...); err != nil {
+		c.setErr(err)
+		return nil, false
+	}
+	return vals, true
+}
+
+// the error of the query, moving to the next row, scanning or the context, nil if the end is reached normally.
+func (c *Rows) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Rows) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		if c.stmt != nil {
+			err = c.stmt.wrapError("iterate", err)
+		}
+		c.err = err
+	}
+}
+
+// stop iterating and close the rows, the result of Err() is returned.
+func (c *Rows) Close() error {
+	c.stop.Do(func() {
+		close(c.done)
+	})
+	if c.stopped != nil {
+		// the rows are released by the goroutine
+		<-c.stopped
+	} else {
+		c.release()
+	}
+	return c.Err()
+}
+
+func (c *Rows) release() {
+	c.closeRows.Do(func() {
+		if c.rows != nil {
+			c.rows.Close()
+		}
+		if c.sess != nil {
+			c.sess.Close()
+		}
+		c.loaded = nil
+	})
+}
+
+// a channel of new beans of the rows. It is closed at the end, or when Close() is called or the context is done.
+// Err() tells the error after the channel is closed. Chan() must be called once, and Next() must not be used with it.
+func (c *Rows) Chan() (<-chan interface{}) {
+	ch := make(chan interface{})
+	c.stopped = make(chan struct{})
+	go func() {
+		defer close(c.stopped)
+		defer close(ch)
+		defer c.release()
+
+		if c.stmt == nil {
+			return
+		}
+		for {
+			bean := newBeanOf(c.bean)
+			if !c.next(bean) {
+				return
+			}
+			select {
+			case ch <- bean:
+			case <-c.done:
+				return
+			case <-c.ctx.Done():
+				c.setErr(c.ctx.Err())
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func newBeanOf(bean interface{}) interface{} {
+	return reflect.New(reflect.Indirect(reflect.ValueOf(bean)).Type()).Interface()
+}
+
+func resetBean(bean interface{}) {
+	if v := reflect.ValueOf(bean); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// fill the fields of bean with the values of cols, converted like xorm does. The columns not mapped are ignored.
+func (db *DBI) scanBean(bean interface{}, cols []string, vals []interface{}) error {
+	bv := reflect.Indirect(reflect.ValueOf(bean))
+	if bv.Kind() != reflect.Struct {
+		return fmt.Errorf("bean must be a struct, but %v given", bv.Kind())
+	}
+	table := db.TableInfo(bean)
+	if table == nil || table.Table == nil {
+		return fmt.Errorf("failed to map bean %T", bean)
+	}
+	seen := make(map[string]int, len(cols))
+	for i, name := range cols {
+		idx := seen[name]
+		seen[name] = idx + 1
+		col := table.GetColumnIdx(name, idx)
+		if col == nil || col.MapType == core.ONLYTODB {
+			continue
+		}
+		fv, err := col.ValueOfV(&bv)
+		if err != nil {
+			return err
+		}
+		if !fv.IsValid() || !fv.CanSet() {
+			continue
+		}
+		if err = db.assign(col, *fv, vals[i]); err != nil {
+			return fmt.Errorf("failed to scan column %s: %v", name, err)
+		}
+	}
+	if p, ok := bean.(xorm.AfterLoadProcessor); ok {
+		p.AfterLoad()
+	}
+	return nil
+}
+
+func (db *DBI) assign(col *core.Column, fv reflect.Value, src interface{}) error {
+	if src == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+	if fv.CanAddr() {
+		switch p := fv.Addr().Interface().(type) {
+		case sql.Scanner:
+			return p.Scan(src)
+		case core.Conversion:
+			return p.FromDB(asBytes(src))
+		}
+	}
+	if fv.Kind() == reflect.Ptr {
+		v := reflect.New(fv.Type().Elem())
+		if err := db.assign(col, v.Elem(), src); err != nil {
+			return err
+		}
+		fv.Set(v)
+		return nil
+	}
+	if fv.Type() == timeType {
+		t, err := db.parseTime(col, src)
+		if err == nil {
+			fv.Set(reflect.ValueOf(t))
+		}
+		return err
+	}
+	if col.IsJSON {
+		return json.Unmarshal(asBytes(src), fv.Addr().Interface())
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(asString(src))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(asString(src))
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(asString(src), 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(asString(src), 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(asString(src), 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			fv.SetBytes(asBytes(src))
+			return nil
+		}
+		return json.Unmarshal(asBytes(src), fv.Addr().Interface())
+	case reflect.Map, reflect.Struct, reflect.Array:
+		// stored as JSON by xorm
+		return json.Unmarshal(asBytes(src), fv.Addr().Interface())
+	default:
+		return fmt.Errorf("unsupported type %v", fv.Type())
+	}
+	return nil
+}
+
+// the time read in the time zone of the column or the db, converted to the time zone of the application
+func (db *DBI) parseTime(col *core.Column, src interface{}) (time.Time, error) {
+	loc := db.DatabaseTZ
+	if col.TimeZone != nil {
+		loc = col.TimeZone
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	var t time.Time
+	switch v := src.(type) {
+	case time.Time:
+		t = v
+	case int64:
+		t = time.Unix(v, 0)
+	default:
+		s := strings.TrimSpace(asString(src))
+		if len(s) == 0 || strings.HasPrefix(s, "0000-00-00") {
+			return time.Time{}, nil
+		}
+		var err error
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano, "2006-01-02", "15:04:05"} {
+			if t, err = time.ParseInLocation(layout, s, loc); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return t, err
+		}
+	}
+	if db.TZLocation != nil {
+		t = t.In(db.TZLocation)
+	}
+	return t, nil
+}
+
+func asString(src interface{}) string {
+	switch v := src.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999999")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// the bytes of the driver may be reused by the next row
+func asBytes(src interface{}) []byte {
+	if b, ok := src.([]byte); ok {
+		return append([]byte(nil), b...)
+	}
+	return []byte(asString(src))
+}
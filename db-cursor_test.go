@@ -0,0 +1,272 @@
+package dbx
+
+import (
+	"database/sql/driver"
+	"testing"
+	"context"
+	"strings"
+	"errors"
+	"time"
+	"fmt"
+)
+
+func TestCursor(t *testing.T) {
+	var user sqlTestUser
+	rows := Use("no-such-db").XStmt("user").Cursor(&user)
+	if rows.Next() {
+		t.Fatalf("nothing expected without connection")
+	}
+	if err := rows.Close(); !errors.Is(err, ErrNoConnection) {
+		t.Fatalf("ErrNoConnection expected, got %v", err)
+	}
+
+	rows = Use("no-such-db").XStmt("user").Cursor(&user)
+	for range rows.Chan() {
+		t.Fatalf("nothing expected without connection")
+	}
+	if !errors.Is(rows.Err(), ErrNoConnection) {
+		t.Fatalf("ErrNoConnection expected, got %v", rows.Err())
+	}
+	rows.Close()
+
+	db := newTestDB(t)
+	defer db.Close()
+	db.DryRun()
+	rows = db.XStmt("user").InnerJoin("user", "balance", "user.id=balance.user_id").Cursor(&user)
+	if rows.Next() || rows.Close() != nil {
+		t.Fatalf("nothing to iterate in dry-run mode")
+	}
+	ch, stop := db.XStmt("user").SelectCols("id").Iter(&user)
+	for range ch {
+		t.Fatalf("nothing to iterate in dry-run mode")
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestIterStop(t *testing.T) {
+	db, _ := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		return stubRowsOf("id,name,age", []driver.Value{int64(1), "john", int64(10)}, []driver.Value{int64(2), "rosbit", int64(20)})
+	})
+
+	// stop returns after the goroutine exits and the rows are released
+	ch, stop := db.XStmt("user").Iter(&sqlTestUser{})
+	for u := range ch {
+		if u.(*sqlTestUser).Id != 1 {
+			t.Fatalf("unexpected row %+v", u)
+		}
+		break
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatalf("the channel is expected to be closed by stop")
+	}
+
+	n := 0
+	ch, stop = db.Iter("user", nil, &sqlTestUser{})
+	for range ch {
+		n += 1
+	}
+	if err := stop(); err != nil || n != 2 {
+		t.Fatalf("2 rows expected, got %d, %v", n, err)
+	}
+}
+
+func TestIterateBatches(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	db.DryRun()
+
+	fn := func(batch interface{}) error {
+		t.Fatalf("nothing to iterate in dry-run mode")
+		return nil
+	}
+	var users []sqlTestUser
+	if err := db.XStmt("user").Where(Gt("age", 10)).IterateBatches(&users, 10, fn); err != nil {
+		t.Fatalf("%v", err)
+	}
+	var pUsers []*sqlTestUser
+	if err := db.XStmt("user").InnerJoin("user", "balance", "user.id=balance.user_id").IterateBatches(&pUsers, 10, fn); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := db.XStmt("user").IterateBatches(&users, 0, fn); err == nil {
+		t.Fatalf("error expected for batch size 0")
+	}
+	for _, bad := range []interface{}{users, &[]int{}, nil} {
+		if err := db.XStmt("user").IterateBatches(bad, 10, fn); err == nil {
+			t.Fatalf("error expected for %T", bad)
+		}
+	}
+	if err := Use("no-such-db").XStmt("user").IterateBatches(&users, 10, fn); !errors.Is(err, ErrNoConnection) {
+		t.Fatalf("ErrNoConnection expected, got %v", err)
+	}
+
+	// no query for a bad batch size
+	{
+		db, stub := newStubDB(t, nil)
+		if err := db.XStmt("user").IterateBatches(&users, -1, fn); err == nil || len(stub.Stmts()) != 0 {
+			t.Fatalf("error expected without any query, got %v, %q", err, stub.Stmts())
+		}
+	}
+}
+
+func TestCursorRowsErr(t *testing.T) {
+	errLost := errors.New("connection lost")
+	db, _ := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		r := stubRowsOf("id,name,age", []driver.Value{int64(1), "john", int64(10)}, []driver.Value{int64(2), "rosbit", int64(20)})
+		if strings.Contains(query, "broken") {
+			r.rowsErr = errLost
+		}
+		return r
+	})
+
+	var user sqlTestUser
+	for _, table := range []string{"user", "broken"} {
+		rows := db.XStmt(table).Cursor(&user)
+		n := 0
+		for rows.Next() {
+			n += 1
+			if user.Id != n {
+				t.Fatalf("unexpected row #%d: %+v", n, user)
+			}
+		}
+		err := rows.Close()
+		if n != 2 {
+			t.Fatalf("2 rows expected, got %d", n)
+		}
+		if table == "user" && err != nil {
+			t.Fatalf("no error expected at the end, got %v", err)
+		}
+		if table == "broken" && !errors.Is(err, errLost) {
+			t.Fatalf("the error in the middle of the rows expected, got %v", err)
+		}
+	}
+
+	rows := db.XStmt("broken").Cursor(&user)
+	n := 0
+	for range rows.Chan() {
+		n += 1
+	}
+	if n != 2 || !errors.Is(rows.Err(), errLost) {
+		t.Fatalf("2 rows and the error expected, got %d, %v", n, rows.Err())
+	}
+	rows.Close()
+
+	var users []sqlTestUser
+	err := db.XStmt("broken").IterateBatches(&users, 10, func(batch interface{}) error {
+		t.Fatalf("the partial batch must not be processed")
+		return nil
+	})
+	if !errors.Is(err, errLost) {
+		t.Fatalf("the error in the middle of the rows expected, got %v", err)
+	}
+}
+
+type cursorTestRow struct {
+	Id int64
+	Name *string
+	Score float64
+	Vip bool
+	Tags []string
+	Raw []byte
+	CreatedAt time.Time
+	Ignored string `xorm:"-"`
+}
+
+func TestCursorScan(t *testing.T) {
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		// the text protocol of MySQL, every value is []byte
+		return stubRowsOf("id,name,score,vip,tags,raw,created_at,extra",
+			[]driver.Value{[]byte("1"), []byte("john"), []byte("9.5"), []byte("1"), []byte(`["a","b"]`), []byte("xyz"), []byte("2024-05-06 07:08:09"), []byte("?")},
+			[]driver.Value{int64(2), nil, float64(1), int64(0), nil, nil, time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), nil},
+		)
+	})
+	db.DatabaseTZ, db.TZLocation = time.UTC, time.UTC
+
+	var row cursorTestRow
+	rows := db.XStmt("row").Where(Gt("id", 0)).Cursor(&row)
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatalf("a row expected, got %v", rows.Err())
+	}
+	if row.Id != 1 || row.Name == nil || *row.Name != "john" || row.Score != 9.5 || !row.Vip ||
+		fmt.Sprint(row.Tags) != "[a b]" || string(row.Raw) != "xyz" || !row.CreatedAt.Equal(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)) {
+		t.Fatalf("unexpected row %+v", row)
+	}
+	if !rows.Next() {
+		t.Fatalf("a row expected, got %v", rows.Err())
+	}
+	if row.Id != 2 || row.Name != nil || row.Vip || row.Tags != nil || row.Raw != nil || !row.CreatedAt.Equal(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected row %+v", row)
+	}
+	if rows.Next() || rows.Close() != nil {
+		t.Fatalf("the end expected, got %v", rows.Err())
+	}
+	if stmts := stub.Stmts(); len(stmts) != 1 || stmts[0] != "SELECT * FROM row WHERE (`id` > ?)" {
+		t.Fatalf("unexpected statements %q", stmts)
+	}
+}
+
+func TestCursorInTx(t *testing.T) {
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		return stubRowsOf("id,name,age", []driver.Value{int64(1), "john", int64(10)}, []driver.Value{int64(2), "rosbit", int64(20)})
+	})
+
+	var ids []int
+	err := db.Tx(TxStmts(func(stmt *TxStmt) error {
+		var user sqlTestUser
+		rows := stmt.Table("user").Where(Gt("age", 1)).Cursor(&user)
+		defer rows.Close()
+		for rows.Next() {
+			ids = append(ids, user.Id)
+		}
+		return rows.Err()
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if fmt.Sprint(ids) != "[1 2]" {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+	expected := []string{"BEGIN", "SELECT * FROM user WHERE (`age` > ?)", "COMMIT"}
+	if stmts := stub.Stmts(); fmt.Sprint(stmts) != fmt.Sprint(expected) {
+		t.Fatalf("expected %q, got %q", expected, stmts)
+	}
+}
+
+func TestCursorContext(t *testing.T) {
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		return stubRowsOf("id,name,age", []driver.Value{int64(1), "john", int64(10)}, []driver.Value{int64(2), "rosbit", int64(20)})
+	})
+
+	var user sqlTestUser
+	ctx, cancel := context.WithCancel(context.Background())
+	rows := db.XStmt("user").WithContext(ctx).Cursor(&user)
+	if !rows.Next() {
+		t.Fatalf("a row expected, got %v", rows.Err())
+	}
+	cancel()
+	if rows.Next() || !errors.Is(rows.Err(), context.Canceled) {
+		t.Fatalf("context.Canceled expected, got %v", rows.Err())
+	}
+	if n := stub.OpenRows(); n != 0 {
+		t.Fatalf("the rows are expected to be closed, %d open", n)
+	}
+
+	// the channel is closed without being drained
+	ctx, cancel = context.WithCancel(context.Background())
+	ch, stop := db.XStmt("user").WithContext(ctx).Iter(&user)
+	<-ch
+	cancel()
+	for range ch {
+	}
+	if err := stop(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("context.Canceled expected, got %v", err)
+	}
+	if n := stub.OpenRows(); n != 0 {
+		t.Fatalf("the rows are expected to be closed, %d open", n)
+	}
+}
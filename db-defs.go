@@ -2,6 +2,7 @@ package dbx
 
 import (
 	"github.com/rosbit/xorm"
+	"context"
 )
 
 type (
@@ -33,10 +34,12 @@ type (
 
 	by interface {
 		makeBy(sess *Session) *Session
+		makeByClause() (clause string, isGroupBy bool)
 	}
 
 	limit interface {
 		makeLimit(sess *Session) *Session
+		makeLimitClause() string
 	}
 
 	Set interface {
@@ -48,6 +51,9 @@ type (
 		limit limit
 		session *Session
 		selection string
+		ctx context.Context
+		sqlArgs []interface{}
+		readPrimary bool
 	}
 
 	O func(opts *Options)
@@ -0,0 +1,157 @@
+// classification of database errors
+package dbx
+
+import (
+	"github.com/go-sql-driver/mysql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"fmt"
+)
+
+var (
+	ErrDuplicateKey    = errors.New("duplicate key")
+	ErrDeadlock        = errors.New("deadlock found")
+	ErrLockWaitTimeout = errors.New("lock wait timeout")
+	ErrForeignKey      = errors.New("foreign key constraint fails")
+	ErrDataTooLong     = errors.New("data too long")
+	ErrConnection      = errors.New("connection error")
+
+	ErrNoConnection    = errors.New("no db connection")
+	ErrUnsafeStatement = errors.New("UPDATE/DELETE without WHERE, use dbx.AllRows() to touch all rows")
+)
+
+// mysql error numbers
+var mysqlErrors = map[uint16]error{
+	1022: ErrDuplicateKey,
+	1062: ErrDuplicateKey,
+	1586: ErrDuplicateKey,
+	1213: ErrDeadlock,
+	1205: ErrLockWaitTimeout,
+	1216: ErrForeignKey,
+	1217: ErrForeignKey,
+	1451: ErrForeignKey,
+	1452: ErrForeignKey,
+	1406: ErrDataTooLong,
+	1040: ErrConnection,
+	1053: ErrConnection,
+	2002: ErrConnection,
+	2003: ErrConnection,
+	2006: ErrConnection,
+	2013: ErrConnection,
+}
+
+// Error is returned by statements, with the operation and the table name.
+// errors.Is(err, ErrXxx) tells the kind of the error, errors.Unwrap(err) returns the driver error.
+type Error struct {
+	Op    string
+	Table string
+	Err   error
+	kind  error
+}
+
+func (e *Error) Error() string {
+	if len(e.Table) == 0 {
+		return fmt.Sprintf("%s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Table, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.kind != nil && target == e.kind
+}
+
+func wrapError(op string, table string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		// wrapped already
+		return err
+	}
+	return &Error{Op: op, Table: table, Err: err, kind: classifyError(err)}
+}
+
+// one of ErrXxx, or nil if the error is unknown
+func classifyError(err error) error {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return mysqlErrors[myErr.Number]
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return ErrConnection
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrConnection
+	}
+	return nil
+}
+
+func IsDuplicateKey(err error) bool {
+	return errors.Is(err, ErrDuplicateKey)
+}
+
+func IsDeadlock(err error) bool {
+	return errors.Is(err, ErrDeadlock)
+}
+
+func IsLockWaitTimeout(err error) bool {
+	return errors.Is(err, ErrLockWaitTimeout)
+}
+
+func IsForeignKey(err error) bool {
+	return errors.Is(err, ErrForeignKey)
+}
+
+func IsDataTooLong(err error) bool {
+	return errors.Is(err, ErrDataTooLong)
+}
+
+func IsConnection(err error) bool {
+	return errors.Is(err, ErrConnection)
+}
+
+// a panic in FnTxStmt
+type TxPanicError struct {
+	Value interface{} // the value passed to panic()
+	Stack []byte
+}
+
+func (e *TxPanicError) Error() string {
+	return fmt.Sprintf("panic in transaction: %v", e.Value)
+}
+
+// the value of panic if it is an error
+func (e *TxPanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// the transaction failed with Err, and failed to rollback with RollbackErr
+type RollbackError struct {
+	Err error
+	RollbackErr error
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("%v; rollback: %v", e.Err, e.RollbackErr)
+}
+
+// errors.Is()/errors.As() match both of the errors, Err by Unwrap() and RollbackErr by Is()/As()
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RollbackError) Is(target error) bool {
+	return e.RollbackErr != nil && errors.Is(e.RollbackErr, target)
+}
+
+func (e *RollbackError) As(target interface{}) bool {
+	return e.RollbackErr != nil && errors.As(e.RollbackErr, target)
+}
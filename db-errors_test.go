@@ -0,0 +1,72 @@
+package dbx
+
+import (
+	"github.com/go-sql-driver/mysql"
+	"database/sql/driver"
+	"database/sql"
+	"testing"
+	"errors"
+	"fmt"
+)
+
+func TestErrors(t *testing.T) {
+	cases := []struct{
+		err error
+		kind error
+		is func(error) bool
+	}{
+		{&mysql.MySQLError{Number:1062, Message:"Duplicate entry '1' for key 'PRIMARY'"}, ErrDuplicateKey, IsDuplicateKey},
+		{&mysql.MySQLError{Number:1213, Message:"Deadlock found"}, ErrDeadlock, IsDeadlock},
+		{&mysql.MySQLError{Number:1205, Message:"Lock wait timeout exceeded"}, ErrLockWaitTimeout, IsLockWaitTimeout},
+		{&mysql.MySQLError{Number:1452, Message:"Cannot add or update a child row"}, ErrForeignKey, IsForeignKey},
+		{&mysql.MySQLError{Number:1406, Message:"Data too long for column"}, ErrDataTooLong, IsDataTooLong},
+		{driver.ErrBadConn, ErrConnection, IsConnection},
+		{fmt.Errorf("query: %w", mysql.ErrInvalidConn), ErrConnection, IsConnection},
+	}
+	for _, c := range cases {
+		err := wrapError("insert", "user", c.err)
+		if !errors.Is(err, c.kind) || !c.is(err) {
+			t.Fatalf("%v is expected to be %v", err, c.kind)
+		}
+		if !errors.Is(err, c.err) {
+			t.Fatalf("%v is expected to wrap %v", err, c.err)
+		}
+		var e *Error
+		if !errors.As(err, &e) || e.Op != "insert" || e.Table != "user" {
+			t.Fatalf("unexpected error %#v", err)
+		}
+	}
+
+	err := wrapError("get", "user", sql.ErrNoRows)
+	if !errors.Is(err, sql.ErrNoRows) || IsDuplicateKey(err) || IsConnection(err) {
+		t.Fatalf("unexpected classification of %v", err)
+	}
+	if wrapError("get", "user", nil) != nil {
+		t.Fatalf("nil is expected")
+	}
+	if wrapError("update", "order", err) != err {
+		t.Fatalf("error should not be wrapped twice")
+	}
+}
+
+func TestTxErrors(t *testing.T) {
+	cause := errors.New("insufficient balance")
+	var err error = &TxPanicError{Value: cause, Stack: []byte("stack")}
+	if !errors.Is(err, cause) {
+		t.Fatalf("%v is expected to wrap %v", err, cause)
+	}
+	err = &TxPanicError{Value: "oops"}
+	if errors.Unwrap(err) != nil || err.Error() != "panic in transaction: oops" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	err = &RollbackError{Err: wrapError("update", "user", &mysql.MySQLError{Number:1213}), RollbackErr: driver.ErrBadConn}
+	if !IsDeadlock(err) || !errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("both errors are expected to be matched by %v", err)
+	}
+	err = &RollbackError{Err: errors.New("failed"), RollbackErr: wrapError("rollback", "", &mysql.MySQLError{Number:2013})}
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) || me.Number != 2013 || errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("only the rollback error is expected to be matched by %v", err)
+	}
+}
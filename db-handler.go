@@ -1,5 +1,9 @@
 package dbx
 
+import (
+	"fmt"
+)
+
 func (db *DBI) QueryStmt(tblName string, conds []Cond, options ...O) *queryStmt {
 	opts := getOptions(options...)
 
@@ -9,10 +13,12 @@ func (db *DBI) QueryStmt(tblName string, conds []Cond, options ...O) *queryStmt
 			table: tblName,
 			conds: conds,
 			session: opts.session,
+			ctx: opts.ctx,
 		},
 		bys: opts.bys,
 		limit: opts.limit,
 		selection: opts.selection,
+		readPrimary: opts.readPrimary,
 	}
 }
 
@@ -30,9 +36,12 @@ func (db *DBI) SelectStmt(tblName string, fields []string, conds []Cond, options
 }
 
 func (db *DBI) SqlStmt(tblName string, sql string, options ...O) *sqlStmt {
+	opts := getOptions(options...)
+	sql, args := bindArgs(sql, opts.sqlArgs)
 	return &sqlStmt{
 		listStmt: db.ListStmt(tblName, nil, options...),
 		sql: sql,
+		args: args,
 	}
 }
 
@@ -80,6 +89,7 @@ func (db *DBI) InsertStmt(tblName string, options ...O) *insertStmt {
 		execStmt: &execStmt{
 			engine: db,
 			session: opts.session,
+			ctx: opts.ctx,
 			table: tblName,
 		},
 	}
@@ -91,6 +101,7 @@ func (db *DBI) UpdateStmt(tblName string, conds []Cond, cols []string, options .
 		execStmt: &execStmt{
 			engine: db,
 			session: opts.session,
+			ctx: opts.ctx,
 			table: tblName,
 			conds: conds,
 		},
@@ -100,13 +111,16 @@ func (db *DBI) UpdateStmt(tblName string, conds []Cond, cols []string, options .
 
 func (db *DBI) UpdateSqlStmt(tblName string, sql string, options ...O) *rawUpdateStmt {
 	opts := getOptions(options...)
+	sql, args := bindArgs(sql, opts.sqlArgs)
 	return &rawUpdateStmt{
 		execStmt: &execStmt{
 			engine: db,
 			session: opts.session,
+			ctx: opts.ctx,
 			table: tblName,
 		},
 		sql: sql,
+		args: args,
 	}
 }
 
@@ -116,6 +130,7 @@ func (db *DBI) UpdateSetStmt(tblName string, sets []Set, conds []Cond, options .
 		execStmt: &execStmt{
 			engine: db,
 			session: opts.session,
+			ctx: opts.ctx,
 			table: tblName,
 			conds: conds,
 		},
@@ -123,12 +138,28 @@ func (db *DBI) UpdateSetStmt(tblName string, sets []Set, conds []Cond, options .
 	}
 }
 
+// cols or sets are used to update the duplicated row, all inserted columns except the primary keys are updated if both are empty
+func (db *DBI) UpsertStmt(tblName string, cols []string, sets []Set, options ...O) *upsertStmt {
+	opts := getOptions(options...)
+	return &upsertStmt{
+		execStmt: &execStmt{
+			engine: db,
+			session: opts.session,
+			ctx: opts.ctx,
+			table: tblName,
+		},
+		cols: cols,
+		sets: sets,
+	}
+}
+
 func (db *DBI) DeleteStmt(tblName string, conds []Cond, options ...O) *deleteStmt {
 	opts := getOptions(options...)
 	return &deleteStmt{
 		execStmt: &execStmt{
 			engine: db,
 			session: opts.session,
+			ctx: opts.ctx,
 			table: tblName,
 			conds: conds,
 		},
@@ -185,6 +216,11 @@ func UpdateSetStmt(tblName string, sets []Set, conds []Cond, options ...O) *upda
 	return db.UpdateSetStmt(tblName, sets, conds, options...)
 }
 
+func UpsertStmt(tblName string, cols []string, sets []Set, options ...O) *upsertStmt {
+	db := getDefaultConnection()
+	return db.UpsertStmt(tblName, cols, sets, options...)
+}
+
 func DeleteStmt(tblName string, conds []Cond, options ...O) *deleteStmt {
 	db := getDefaultConnection()
 	return db.DeleteStmt(tblName, conds, options...)
@@ -252,6 +288,11 @@ func (db *DBI) Insert(tblName string, vals interface{}, options ...O) error {
 	return err
 }
 
+// vals is a bean or a slice of beans, the auto-increment ids are filled back
+func (db *DBI) InsertWithResult(tblName string, vals interface{}, options ...O) (*InsertResult, error) {
+	return db.InsertStmt(tblName, options...).ExecWithResult(vals)
+}
+
 func (db *DBI) Update(tblName string, conds []Cond, cols []string, vals interface{}, options ...O) (int64, error) {
 	ac, err := db.UpdateStmt(tblName, conds, cols, options...).Exec(vals)
 	return ac.(int64), err
@@ -262,9 +303,20 @@ func (db *DBI) UpdateSet(tblName string, sets []Set, conds []Cond, options ...O)
 	return ac.(int64), err
 }
 
-func (db *DBI) Delete(tblName string, conds []Cond, vals interface{}, options ...O) error {
-	_, err := db.DeleteStmt(tblName, conds, options...).Exec(vals)
-	return err
+// vals is a bean or a slice of beans, returns 1 for each inserted row, 2 for each updated row
+func (db *DBI) Upsert(tblName string, vals interface{}, cols []string, sets []Set, options ...O) (int64, error) {
+	ac, err := db.UpsertStmt(tblName, cols, sets, options...).Exec(vals)
+	return ac.(int64), err
+}
+
+// vals is a bean whose non-zero fields are conditions too, or nil
+func (db *DBI) Delete(tblName string, conds []Cond, vals interface{}, options ...O) (int64, error) {
+	ac, err := db.DeleteStmt(tblName, conds, options...).Exec(vals)
+	return ac.(int64), err
+}
+
+func (db *DBI) DeleteWhere(tblName string, conds []Cond, options ...O) (int64, error) {
+	return db.Delete(tblName, conds, nil, options...)
 }
 
 func (db *DBI) RunSQL(tblName string, sql string, res interface{}, options ...O) error {
@@ -278,11 +330,26 @@ func (db *DBI) ExecSQL(tblName string, sql string, options ...O) (int64, error)
 	return ac.(int64), err
 }
 
-func (db *DBI) Iter(tblName string, conds []Cond, bean interface{}, options ...O) (<-chan interface{}) {
+// args are bound to "?" in sql, or to ":name" if args is dbx.Named(...)
+func (db *DBI) RunSQLArgs(tblName string, sql string, res interface{}, args ...interface{}) error {
+	return db.RunSQL(tblName, sql, res, SqlArgs(args...))
+}
+
+func (db *DBI) ExecSQLArgs(tblName string, sql string, args ...interface{}) (int64, error) {
+	return db.ExecSQL(tblName, sql, SqlArgs(args...))
+}
+
+// stop must be called to release the rows if the loop is stopped early, it returns the error of the rows.
+func (db *DBI) Iter(tblName string, conds []Cond, bean interface{}, options ...O) (<-chan interface{}, func() error) {
 	stmt := db.QueryStmt(tblName, conds, options...)
 	return stmt.Iter(bean)
 }
 
+func (db *DBI) Cursor(tblName string, conds []Cond, bean interface{}, options ...O) *Rows {
+	stmt := db.QueryStmt(tblName, conds, options...)
+	return stmt.Cursor(bean)
+}
+
 func (db *DBI) Iterate(tblName string, conds []Cond, bean interface{}, it FnIterate, options ...O) error {
 	stmt := db.QueryStmt(tblName, conds, options...)
 	return stmt.Iterate(bean, it)
@@ -327,6 +394,11 @@ func Insert(tblName string, vals interface{}, options ...O) error {
 	return db.Insert(tblName, vals, options...)
 }
 
+func InsertWithResult(tblName string, vals interface{}, options ...O) (*InsertResult, error) {
+	db := getDefaultConnection()
+	return db.InsertWithResult(tblName, vals, options...)
+}
+
 func Update(tblName string, conds []Cond, cols []string, vals interface{}, options ...O) (int64, error) {
 	db := getDefaultConnection()
 	return db.Update(tblName, conds, cols, vals, options...)
@@ -337,21 +409,51 @@ func UpdateSet(tblName string, sets []Set, conds []Cond, options ...O) (int64, e
 	return db.UpdateSet(tblName, sets, conds, options...)
 }
 
-func Delete(tblName string, conds []Cond, vals interface{}, options ...O) error {
+func Upsert(tblName string, vals interface{}, cols []string, sets []Set, options ...O) (int64, error) {
+	db := getDefaultConnection()
+	return db.Upsert(tblName, vals, cols, sets, options...)
+}
+
+func Delete(tblName string, conds []Cond, vals interface{}, options ...O) (int64, error) {
 	db := getDefaultConnection()
 	return db.Delete(tblName, conds, vals, options...)
 }
 
+func DeleteWhere(tblName string, conds []Cond, options ...O) (int64, error) {
+	db := getDefaultConnection()
+	return db.DeleteWhere(tblName, conds, options...)
+}
+
 func RunSQL(tblName string, sql string, res interface{}, options ...O) error {
 	db := getDefaultConnection()
 	return db.RunSQL(tblName, sql, res, options...)
 }
 
-func Iter(tblName string, conds []Cond, bean interface{}, options ...O) (<-chan interface{}) {
+func RunSQLArgs(tblName string, sql string, res interface{}, args ...interface{}) error {
+	db := getDefaultConnection()
+	return db.RunSQLArgs(tblName, sql, res, args...)
+}
+
+func ExecSQL(tblName string, sql string, options ...O) (int64, error) {
+	db := getDefaultConnection()
+	return db.ExecSQL(tblName, sql, options...)
+}
+
+func ExecSQLArgs(tblName string, sql string, args ...interface{}) (int64, error) {
+	db := getDefaultConnection()
+	return db.ExecSQLArgs(tblName, sql, args...)
+}
+
+func Iter(tblName string, conds []Cond, bean interface{}, options ...O) (<-chan interface{}, func() error) {
 	db := getDefaultConnection()
 	return db.Iter(tblName, conds, bean, options...)
 }
 
+func Cursor(tblName string, conds []Cond, bean interface{}, options ...O) *Rows {
+	db := getDefaultConnection()
+	return db.Cursor(tblName, conds, bean, options...)
+}
+
 func Iterate(tblName string, conds []Cond, bean interface{}, it FnIterate, options ...O) error {
 	db := getDefaultConnection()
 	return db.Iterate(tblName, conds, bean, it, options...)
@@ -359,23 +461,51 @@ func Iterate(tblName string, conds []Cond, bean interface{}, it FnIterate, optio
 
 // some statistic func
 func (stmt *queryStmt) Count(bean interface{}) (int64, error) {
+	if err := stmt.engine.checkConn(); err != nil {
+		return 0, err
+	}
+	if stmt.engine.IsDryRun() {
+		return 0, stmt.engine.logDryRun(stmt.selectSQL("count(*)"))
+	}
 	sess := stmt.createQuerySession()
-	return sess.Count(bean)
+	count, err := sess.Count(bean)
+	return count, stmt.wrapError("count", err)
 }
 
 func (stmt *queryStmt) Sum(bean interface{}, col string) (float64, error) {
+	if err := stmt.engine.checkConn(); err != nil {
+		return 0, err
+	}
+	if stmt.engine.IsDryRun() {
+		return 0, stmt.engine.logDryRun(stmt.selectSQL(fmt.Sprintf("sum(%s)", col)))
+	}
 	sess := stmt.createQuerySession()
-	return sess.Sum(bean, col)
+	sum, err := sess.Sum(bean, col)
+	return sum, stmt.wrapError("sum", err)
 }
 
 func (stmt *joinStmt) Count(bean interface{}) (int64, error) {
+	if err := stmt.engine.checkConn(); err != nil {
+		return 0, err
+	}
+	if stmt.engine.IsDryRun() {
+		return 0, stmt.engine.logDryRun(stmt.selectSQL("count(*)"))
+	}
 	sess := stmt.createQuerySession()
-	return sess.Count(bean)
+	count, err := sess.Count(bean)
+	return count, stmt.wrapError("count", err)
 }
 
 func (stmt *joinStmt) Sum(bean interface{}, col string) (float64, error) {
+	if err := stmt.engine.checkConn(); err != nil {
+		return 0, err
+	}
+	if stmt.engine.IsDryRun() {
+		return 0, stmt.engine.logDryRun(stmt.selectSQL(fmt.Sprintf("sum(%s)", col)))
+	}
 	sess := stmt.createQuerySession()
-	return sess.Sum(bean, col)
+	sum, err := sess.Sum(bean, col)
+	return sum, stmt.wrapError("sum", err)
 }
 
 func getOptions(options ...O) *Options {
@@ -1,6 +1,7 @@
 package dbx
 
 import (
+	"context"
 	"reflect"
 	"strings"
 )
@@ -10,18 +11,27 @@ func Where(eq ...Cond) []Cond {
 	return eq
 }
 
+// UPDATE/DELETE all rows explicitly when safe writes is on
+func AllRows() Cond {
+	return &allRowsCond{}
+}
+
 func Cols(field ...string) []string {
 	return field
 }
 
-func OnlyCond(cond string) AndElem {
-	return wrapperAndElem(&onlyCond{cond:cond})
+// args are bound to "?" in cond, or to ":name" if args is dbx.Named(...)
+func OnlyCond(cond string, args ...interface{}) AndElem {
+	cond, args = bindArgs(cond, args)
+	return wrapperAndElem(&onlyCond{cond:cond, args:args})
 }
 
+// a nil val, nil pointer or invalid sql.NullXxx makes "IS NULL"
 func Eq(fieldName string, val interface{}) AndElem {
 	return wrapperAndElem(&eqCond{field:fieldName, val:val})
 }
 
+// a nil val, nil pointer or invalid sql.NullXxx makes "IS NOT NULL"
 func Ne(fieldName string, val interface{}) AndElem {
 	return Op(fieldName, "<>", val)
 }
@@ -74,6 +84,7 @@ func Not(cond ...AndElem) AndElem {
 	return wrapperAndElem(&notCond{conds:cond})
 }
 
+// val can be a *DBXStmt to make a sub-query, which is wrapped in a derived table if it has LIMIT
 func In(fieldName string, val ...interface{}) AndElem {
 	return wrapperAndElem(&inCond{field:fieldName, val:copy_i(val...)})
 }
@@ -82,8 +93,61 @@ func NotIn(fieldName string, val ...interface{}) AndElem {
 	return wrapperAndElem(&notInCond{field:fieldName, val:copy_i(val...)})
 }
 
-func Sql(sql string) Cond {
-	return &sqlCond{sql}
+func IsNull(fieldName string) AndElem {
+	return wrapperAndElem(&nullCond{field:fieldName, prep:"IS NULL"})
+}
+
+func IsNotNull(fieldName string) AndElem {
+	return wrapperAndElem(&nullCond{field:fieldName, prep:"IS NOT NULL"})
+}
+
+func Exists(stmt *DBXStmt) AndElem {
+	return wrapperAndElem(&existsCond{stmt:stmt, prep:"EXISTS"})
+}
+
+func NotExists(stmt *DBXStmt) AndElem {
+	return wrapperAndElem(&existsCond{stmt:stmt, prep:"NOT EXISTS"})
+}
+
+func Between(fieldName string, lo, hi interface{}) AndElem {
+	return wrapperAndElem(&betweenCond{field:fieldName, lo:lo, hi:hi, prep:"BETWEEN"})
+}
+
+func NotBetween(fieldName string, lo, hi interface{}) AndElem {
+	return wrapperAndElem(&betweenCond{field:fieldName, lo:lo, hi:hi, prep:"NOT BETWEEN"})
+}
+
+// pattern is used as is, the part from user input must be escaped with EscapeLike()
+func Like(fieldName string, pattern string) AndElem {
+	return wrapperAndElem(&likeCond{field:fieldName, pattern:pattern, prep:"LIKE"})
+}
+
+func NotLike(fieldName string, pattern string) AndElem {
+	return wrapperAndElem(&likeCond{field:fieldName, pattern:pattern, prep:"NOT LIKE"})
+}
+
+func Contains(fieldName string, val string) AndElem {
+	return Like(fieldName, "%"+EscapeLike(val)+"%")
+}
+
+func HasPrefix(fieldName string, val string) AndElem {
+	return Like(fieldName, EscapeLike(val)+"%")
+}
+
+func HasSuffix(fieldName string, val string) AndElem {
+	return Like(fieldName, "%"+EscapeLike(val))
+}
+
+// escape the wildcards "%" and "_" in val, so they are matched literally
+func EscapeLike(val string) string {
+	return likeEscaper.Replace(val)
+}
+
+// the whole statement of a query, instead of a condition. use OnlyCond() for a condition.
+// args are bound to "?" in sql, or to ":name" if args is dbx.Named(...)
+func Sql(sql string, args ...interface{}) Cond {
+	sql, args = bindArgs(sql, args)
+	return &sqlCond{sql, args}
 }
 
 func copy_i(vals ...interface{}) []interface{} {
@@ -164,6 +228,20 @@ func WithSession(session *Session) O {
 	}
 }
 
+// ctx is passed down to the xorm session and the driver
+func WithContext(ctx context.Context) O {
+	return func(opts *Options) {
+		opts.ctx = ctx
+	}
+}
+
+// args of SqlStmt/UpdateSqlStmt/RunSQL/ExecSQL, or a dbx.Named(...)
+func SqlArgs(args ...interface{}) O {
+	return func(opts *Options) {
+		opts.sqlArgs = args
+	}
+}
+
 func SelectCols(selection string) O {
 	return func(opts *Options) {
 		opts.selection = selection
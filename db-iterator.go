@@ -1,73 +1,131 @@
 package dbx
 
-// ---- BEGIN: iterate result set with channel ----
-func (stmt *queryStmt) Iter(bean interface{}) (<-chan interface{}) {
-	sess := stmt.createQuerySession(nil)
-	return iter(sess, bean)
+import (
+	"reflect"
+)
+
+// ---- BEGIN: iterate result set with cursor ----
+func (stmt *queryStmt) Cursor(bean interface{}) *Rows {
+	query, args, err := stmt.selectSQL(stmt.selection)
+	return stmt.cursor(bean, query, args, err)
 }
 
-func (stmt *listStmt) Iter(bean interface{}) (<-chan interface{}) {
-	sess := stmt.queryStmt.createQuerySession(nil)
-	return stmt.iter(sess, bean)
+func (stmt *listStmt) Cursor(bean interface{}) *Rows {
+	query, args, err := stmt.ToSQL()
+	return stmt.cursor(bean, query, args, err)
 }
 
-func (stmt *selectStmt) Iter(bean interface{}) (<-chan interface{}) {
-	sess := stmt.queryStmt.createQuerySession(nil, map[string]interface{}{_select:stmt.fields})
-	return stmt.listStmt.iter(sess, bean)
+func (stmt *selectStmt) Cursor(bean interface{}) *Rows {
+	query, args, err := stmt.ToSQL()
+	return stmt.cursor(bean, query, args, err)
 }
 
-func (stmt *sqlStmt) Iter(bean interface{}) (<-chan interface{}) {
-	sess := stmt.queryStmt.createQuerySession(nil, map[string]interface{}{_sql:stmt.sql})
-	return stmt.listStmt.iter(sess, bean)
+func (stmt *sqlStmt) Cursor(bean interface{}) *Rows {
+	query, args, err := stmt.ToSQL()
+	return stmt.cursor(bean, query, args, err)
 }
 
-func (stmt *listStmt) iter(sess *Session, bean interface{}) (<-chan interface{}) {
-	if stmt.limit != nil {
-		sess = stmt.limit.makeLimit(sess)
+func (stmt *joinStmt) Cursor(bean interface{}) *Rows {
+	query, args, err := stmt.ToSQL()
+	return stmt.cursor(bean, query, args, err)
+}
+
+// the rendered query is run, the session routes it to the primary or a replica
+func (stmt *queryStmt) cursor(bean interface{}, query string, args []interface{}, err error) *Rows {
+	if err := stmt.engine.checkConn(); err != nil {
+		return errRows(err)
+	}
+	if err != nil {
+		return errRows(err)
+	}
+	if stmt.engine.IsDryRun() {
+		return errRows(stmt.engine.logDryRun(query, args, nil))
 	}
-	return iter(sess, bean)
+	sess := stmt.createQuerySession(nil)
+	return newRows(stmt.execStmt, sess, bean, query, args)
 }
+// ---- END: iterate result set with cursor ----
 
-func (stmt *joinStmt) Iter(bean interface{}) (<-chan interface{}) {
-	sess := stmt.createQuerySession()
-	return stmt.listStmt.iter(sess, bean)
+// ---- BEGIN: iterate result set with channel ----
+// the channel is closed at the end, when stop is called, or when the context is done.
+// stop must be called to release the rows when stopping early, it returns the error of the rows.
+func (stmt *queryStmt) Iter(bean interface{}) (<-chan interface{}, func() error) {
+	return iter(stmt.Cursor(bean))
+}
+
+func (stmt *listStmt) Iter(bean interface{}) (<-chan interface{}, func() error) {
+	return iter(stmt.Cursor(bean))
+}
+
+func (stmt *selectStmt) Iter(bean interface{}) (<-chan interface{}, func() error) {
+	return iter(stmt.Cursor(bean))
+}
+
+func (stmt *sqlStmt) Iter(bean interface{}) (<-chan interface{}, func() error) {
+	return iter(stmt.Cursor(bean))
 }
 
-func iter(sess *Session, bean interface{}) (<-chan interface{}) {
-	c := make(chan interface{})
-	go func() {
-		sess.Iterate(bean, func(_ int, bean interface{})error{
-			c <- bean
-			return nil
-		})
-		close(c)
-	}()
-	return c
+func (stmt *joinStmt) Iter(bean interface{}) (<-chan interface{}, func() error) {
+	return iter(stmt.Cursor(bean))
+}
+
+func iter(rows *Rows) (<-chan interface{}, func() error) {
+	return rows.Chan(), rows.Close
 }
 // ---- END: iterate result set with channel ----
 
 // ---- BEGIN: iterate result set using callback ----
 func (stmt *queryStmt) Iterate(bean interface{}, it FnIterate) error {
+	if err := stmt.engine.checkConn(); err != nil {
+		return err
+	}
+	if stmt.engine.IsDryRun() {
+		return stmt.engine.logDryRun(stmt.selectSQL(stmt.selection))
+	}
 	sess := stmt.createQuerySession(nil)
-	return sess.Iterate(bean, it)
+	return stmt.wrapError("iterate", sess.Iterate(bean, it))
 }
 
 func (stmt *listStmt) Iterate(bean interface{}, it FnIterate) error {
+	if err := stmt.engine.checkConn(); err != nil {
+		return err
+	}
+	if stmt.engine.IsDryRun() {
+		return stmt.engine.logDryRun(stmt.ToSQL())
+	}
 	sess := stmt.queryStmt.createQuerySession(nil)
 	return stmt.iterate(sess, bean, it)
 }
 
 func (stmt *selectStmt) Iterate(bean interface{}, it FnIterate) error {
-	sess := stmt.queryStmt.createQuerySession(nil, map[string]interface{}{_select:stmt.fields})
+	if err := stmt.engine.checkConn(); err != nil {
+		return err
+	}
+	if stmt.engine.IsDryRun() {
+		return stmt.engine.logDryRun(stmt.ToSQL())
+	}
+	sess := stmt.queryStmt.createQuerySession(map[string]interface{}{_select:stmt.fields})
 	return stmt.listStmt.iterate(sess, bean, it)
 }
 
 func (stmt *sqlStmt) Iterate(bean interface{}, it FnIterate) error {
-	sess := stmt.queryStmt.createQuerySession(nil, map[string]interface{}{_sql:stmt.sql})
+	if err := stmt.engine.checkConn(); err != nil {
+		return err
+	}
+	if stmt.engine.IsDryRun() {
+		return stmt.engine.logDryRun(stmt.ToSQL())
+	}
+	sess := stmt.queryStmt.createQuerySession(map[string]interface{}{_sql:stmt})
 	return stmt.listStmt.iterate(sess, bean, it)
 }
 
 func (stmt *joinStmt) Iterate(bean interface{}, it FnIterate) error {
+	if err := stmt.engine.checkConn(); err != nil {
+		return err
+	}
+	if stmt.engine.IsDryRun() {
+		return stmt.engine.logDryRun(stmt.ToSQL())
+	}
 	sess := stmt.createQuerySession()
 	return stmt.listStmt.iterate(sess, bean, it)
 }
@@ -76,8 +134,57 @@ func (stmt *listStmt) iterate(sess *Session, bean interface{}, it FnIterate) err
 	if stmt.limit != nil {
 		sess = stmt.limit.makeLimit(sess)
 	}
-	return sess.Iterate(bean, it)
+	return stmt.wrapError("iterate", sess.Iterate(bean, it))
 }
 
 // ---- END: iterate result set using callback ----
 
+// ---- BEGIN: iterate result set in batches ----
+// fill the slice pointed by slicePtr with at most batchSize rows and call fn with the slice,
+// the slice is reused for the next batch, so it must not be kept after fn returns.
+// slicePtr and batchSize are checked before the query is run.
+func iterateBatches(rows *Rows, slicePtr interface{}, batchSize int, fn func(batch interface{}) error) error {
+	defer rows.Close()
+
+	slice := reflect.ValueOf(slicePtr).Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if slice.Cap() < batchSize {
+		slice.Set(reflect.MakeSlice(slice.Type(), 0, batchSize))
+	} else {
+		slice.SetLen(0)
+	}
+
+	for {
+		n := slice.Len()
+		slice.SetLen(n+1)
+		e := slice.Index(n)
+		var bean interface{}
+		if isPtr {
+			if e.IsNil() {
+				e.Set(reflect.New(elemType.Elem()))
+			}
+			bean = e.Interface()
+		} else {
+			bean = e.Addr().Interface()
+		}
+		if !rows.next(bean) {
+			slice.SetLen(n)
+			break
+		}
+		if n+1 == batchSize {
+			if err := fn(slice.Interface()); err != nil {
+				return err
+			}
+			slice.SetLen(0)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if slice.Len() > 0 {
+		return fn(slice.Interface())
+	}
+	return nil
+}
+// ---- END: iterate result set in batches ----
@@ -0,0 +1,194 @@
+// keyset pagination
+package dbx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"errors"
+	"time"
+	"fmt"
+)
+
+var errNoKeyColumns = errors.New("keyset pagination needs Asc()/Desc() key columns")
+
+type keyColumn struct {
+	name string
+	desc bool
+}
+
+// rows after the cursor returned by Page(), an empty cursor means the first page.
+func (s *dbxStmt) After(cursor string) *dbxStmt {
+	s.after = cursor
+	return s
+}
+
+// list at most size rows ordered by the key columns given by Asc()/Desc(), from the cursor given by After().
+// The cursor of the next page is returned, which is empty if there's no more rows.
+// The last key column should be unique (the primary key, for example) and the key columns must not be NULL.
+//  eg. next, err := db.XStmt("user").Desc("created_at").Asc("id").After(cursor).Page(20, &users)
+func (s *dbxStmt) Page(size int, res interface{}) (next string, err error) {
+	if size <= 0 {
+		return "", fmt.Errorf("bad page size %d", size)
+	}
+	keys := s.keyColumns()
+	if len(keys) == 0 {
+		return "", errNoKeyColumns
+	}
+
+	p := *s
+	p.conds = append([]Cond(nil), s.conds...)
+	p.opts = append(append([]O(nil), s.opts...), Limit(size+1))
+	if len(s.after) > 0 {
+		vals, err := decodeCursor(s.after, len(keys))
+		if err != nil {
+			return "", err
+		}
+		p.conds = append(p.conds, keysetCond(keys, vals))
+	}
+	if _, err = sliceElem(res); err != nil {
+		return "", err
+	}
+	rows := reflect.ValueOf(res).Elem()
+	rows.SetLen(0) // the rows are appended by List()
+	if err = p.List(res); err != nil {
+		return "", err
+	}
+	if rows.Len() <= size {
+		return "", nil
+	}
+	rows.SetLen(size)
+	return s.cursorOf(keys, rows.Index(size-1))
+}
+
+func (s *dbxStmt) keyColumns() []keyColumn {
+	var keys []keyColumn
+	for _, b := range getOptions(s.opts...).bys {
+		switch o := b.(type) {
+		case *ascOrderBy:
+			for _, f := range o.fields {
+				keys = append(keys, keyColumn{name: f})
+			}
+		case *descOrderBy:
+			for _, f := range o.fields {
+				keys = append(keys, keyColumn{name: f, desc: true})
+			}
+		}
+	}
+	return keys
+}
+
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with "<" for the DESC columns
+func keysetCond(keys []keyColumn, vals []interface{}) Cond {
+	q := &strings.Builder{}
+	var args []interface{}
+	for i, k := range keys {
+		if i > 0 {
+			q.WriteString(" OR ")
+		}
+		q.WriteString("(")
+		for j:=0; j<i; j++ {
+			backquote := getQuote(keys[j].name)
+			fmt.Fprintf(q, "%s%s%s=? AND ", backquote, keys[j].name, backquote)
+			args = append(args, vals[j])
+		}
+		op := ">"
+		if k.desc {
+			op = "<"
+		}
+		backquote := getQuote(k.name)
+		fmt.Fprintf(q, "%s%s%s%s?)", backquote, k.name, backquote, op)
+		args = append(args, vals[i])
+	}
+	return OnlyCond("(" + q.String() + ")", args...)
+}
+
+// the values of the key columns in the row, "table.col" is mapped with "col"
+func (s *dbxStmt) cursorOf(keys []keyColumn, row reflect.Value) (string, error) {
+	if row.Kind() != reflect.Ptr {
+		row = row.Addr()
+	}
+	cols := make([]string, len(keys))
+	for i, k := range keys {
+		name := k.name
+		if pos := strings.LastIndex(name, "."); pos >= 0 {
+			name = name[pos+1:]
+		}
+		cols[i] = strings.Trim(name, "`")
+	}
+	_, vals, err := s.engine.beanColumns(row.Interface(), cols, false)
+	if err != nil {
+		return "", err
+	}
+	return encodeCursor(vals)
+}
+
+// the type of a value is kept in the cursor, so that it is decoded as is
+type cursorValue [2]string
+
+func encodeCursor(vals []interface{}) (string, error) {
+	cvs := make([]cursorValue, len(vals))
+	for i, val := range vals {
+		v := reflect.ValueOf(val)
+		switch {
+		case val == nil:
+			return "", errors.New("key column of cursor must not be NULL")
+		case v.Type() == reflect.TypeOf(time.Time{}):
+			cvs[i] = cursorValue{"t", val.(time.Time).Format(time.RFC3339Nano)}
+		case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+			cvs[i] = cursorValue{"i", strconv.FormatInt(v.Int(), 10)}
+		case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+			cvs[i] = cursorValue{"u", strconv.FormatUint(v.Uint(), 10)}
+		case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+			cvs[i] = cursorValue{"f", strconv.FormatFloat(v.Float(), 'g', -1, 64)}
+		case v.Kind() == reflect.String:
+			cvs[i] = cursorValue{"s", v.String()}
+		case v.Kind() == reflect.Bool:
+			cvs[i] = cursorValue{"b", strconv.FormatBool(v.Bool())}
+		default:
+			return "", fmt.Errorf("type %T of key column is not supported by cursor", val)
+		}
+	}
+	b, err := json.Marshal(cvs)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(cursor string, count int) ([]interface{}, error) {
+	errBadCursor := fmt.Errorf("bad cursor %q", cursor)
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	var cvs []cursorValue
+	if err = json.Unmarshal(b, &cvs); err != nil || len(cvs) != count {
+		return nil, errBadCursor
+	}
+	vals := make([]interface{}, count)
+	for i, cv := range cvs {
+		switch cv[0] {
+		case "t":
+			vals[i], err = time.Parse(time.RFC3339Nano, cv[1])
+		case "i":
+			vals[i], err = strconv.ParseInt(cv[1], 10, 64)
+		case "u":
+			vals[i], err = strconv.ParseUint(cv[1], 10, 64)
+		case "f":
+			vals[i], err = strconv.ParseFloat(cv[1], 64)
+		case "s":
+			vals[i] = cv[1]
+		case "b":
+			vals[i], err = strconv.ParseBool(cv[1])
+		default:
+			err = errBadCursor
+		}
+		if err != nil {
+			return nil, errBadCursor
+		}
+	}
+	return vals, nil
+}
@@ -0,0 +1,91 @@
+package dbx
+
+import (
+	"database/sql/driver"
+	"testing"
+	"reflect"
+	"strings"
+	"time"
+)
+
+func TestKeyset(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	cursor, err := encodeCursor([]interface{}{created, int64(1)<<60, "a|b", 1.5, uint8(3), true})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	vals, err := decodeCursor(cursor, 6)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !vals[0].(time.Time).Equal(created) || vals[1] != int64(1)<<60 || vals[2] != "a|b" || vals[3] != 1.5 || vals[4] != uint64(3) || vals[5] != true {
+		t.Fatalf("bad values decoded: %v", vals)
+	}
+	if _, err = decodeCursor(cursor, 2); err == nil {
+		t.Fatalf("error expected for a cursor of different key columns")
+	}
+	if _, err = encodeCursor([]interface{}{nil}); err == nil {
+		t.Fatalf("error expected for NULL")
+	}
+
+	s := db.XStmt("user").Where(Gt("age", 10)).Desc("created").Asc("id")
+	keys := s.keyColumns()
+	q, v, err := db.ListStmt("user", Where(Gt("age", 10), keysetCond(keys, []interface{}{created, 100})), Limit(21)).ToSQL()
+	checkSQL(t, "keyset", q, v, err, "SELECT * FROM user WHERE (`age` > ?) AND (((`created`<?) OR (`created`=? AND `id`>?))) LIMIT 21", 10, created, created, 100)
+
+	c, err := s.cursorOf(keys, reflect.ValueOf(&sqlTestKeysetUser{Id: 100, Created: created}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if vals, _ = decodeCursor(c, 2); !vals[0].(time.Time).Equal(created) || vals[1] != int64(100) {
+		t.Fatalf("bad cursor of the row: %v", vals)
+	}
+
+	db.DryRun()
+	var users []sqlTestKeysetUser
+	if next, err := s.After(c).Page(20, &users); err != nil || len(next) > 0 {
+		t.Fatalf("no next page expected in dry-run mode, got %q, %v", next, err)
+	}
+	if _, err := s.After("bad").Page(20, &users); err == nil {
+		t.Fatalf("error expected for a bad cursor")
+	}
+	if _, err := db.XStmt("user").Page(20, &users); err != errNoKeyColumns {
+		t.Fatalf("errNoKeyColumns expected, got %v", err)
+	}
+}
+
+type sqlTestKeysetUser struct {
+	Id int64 `xorm:"pk autoincr"`
+	Created time.Time
+}
+
+func TestKeysetPages(t *testing.T) {
+	var listed []int64
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		r := stubRowsOf("id,name,age")
+		for _, id := range listed {
+			r.rows = append(r.rows, []driver.Value{id, "john", int64(20)})
+		}
+		return r
+	})
+
+	// the slice is reused for the pages
+	var users []sqlTestUser
+	listed = []int64{1, 2, 3}
+	next, err := db.XStmt("user").Asc("id").Page(2, &users)
+	if err != nil || len(next) == 0 || len(users) != 2 || users[1].Id != 2 {
+		t.Fatalf("unexpected page %q %+v %v", next, users, err)
+	}
+	listed = []int64{3}
+	next, err = db.XStmt("user").Asc("id").After(next).Page(2, &users)
+	if err != nil || len(next) != 0 || len(users) != 1 || users[0].Id != 3 {
+		t.Fatalf("unexpected last page %q %+v %v", next, users, err)
+	}
+	stmts := stub.Stmts()
+	if q := stmts[len(stmts)-1]; !strings.Contains(q, "WHERE (((`id`>?)))") {
+		t.Fatalf("the keys after the cursor expected, got %q", q)
+	}
+}
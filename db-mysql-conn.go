@@ -7,14 +7,13 @@ import (
 )
 
 // create a default instance of mysql connection
-func CreateMysqlConnection(dsn string, debug bool) (err error) {
-	DB, err = CreateMysqlInstance(dsn, debug)
-	return
+func CreateMysqlConnection(dsn string, options ...DBOption) error {
+	return CreateDBDriverConnection("mysql", dsn, options...)
 }
 
 // create an instance of mysql connection with an dsn
-func CreateMysqlInstance(dsn string, debug bool) (db *DBI, err error) {
-	return CreateDriverDBInstance("mysql", dsn, debug)
+func CreateMysqlInstance(dsn string, options ...DBOption) (db *DBI, err error) {
+	return CreateDriverDBInstance("mysql", dsn, options...)
 }
 
 // generate mysql DSN
@@ -0,0 +1,179 @@
+// pagination with the total count
+package dbx
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"fmt"
+)
+
+type PageInfo struct {
+	Page      int   // starting from 1
+	PageSize  int
+	Total     int64 // -1 if the count is skipped
+	Pages     int   // -1 if the count is skipped
+	HasNext   bool
+	HasPrev   bool
+	Estimated bool  // Total is estimated
+}
+
+type pageOptions struct {
+	skipCount bool
+	estimated bool
+}
+
+type PageOption func(*pageOptions)
+
+// no count query, HasNext is still known
+func SkipCount() PageOption {
+	return func(opts *pageOptions) {
+		opts.skipCount = true
+	}
+}
+
+// the total is estimated by EXPLAIN, which is much faster than COUNT(*) for large tables.
+// EXPLAIN can't estimate the groups, so the groups are counted exactly if there's GROUP BY.
+func EstimatedCount() PageOption {
+	return func(opts *pageOptions) {
+		opts.estimated = true
+	}
+}
+
+// list the rows of the page, and count the rows with the same conditions and joins, without ORDER BY and LIMIT.
+// The groups are counted if there's GROUP BY.
+//  eg. pi, err := db.XStmt("user").Where(dbx.Gt("age", 10)).Desc("id").Paginate(2, 20, &users)
+func (s *dbxStmt) Paginate(page, pageSize int, res interface{}, options ...PageOption) (pi PageInfo, err error) {
+	if page < 1 || pageSize <= 0 {
+		return pi, fmt.Errorf("bad page %d or page size %d", page, pageSize)
+	}
+	if _, err = sliceElem(res); err != nil {
+		return pi, err
+	}
+	opts := &pageOptions{}
+	for _, o := range options {
+		o(opts)
+	}
+
+	pi = PageInfo{Page: page, PageSize: pageSize, Total: -1, Pages: -1, HasPrev: page > 1}
+	if !opts.skipCount {
+		if opts.estimated && len(s.groupFields()) == 0 {
+			pi.Total, err = s.countStmt().estimatedCount()
+			pi.Estimated = true
+		} else {
+			pi.Total, err = s.count()
+		}
+		if err != nil {
+			return pi, err
+		}
+		pi.Pages = int((pi.Total + int64(pageSize) - 1) / int64(pageSize))
+	}
+
+	// one more row tells if there's the next page
+	p := *s
+	p.opts = append(append([]O(nil), s.opts...), Limit(pageSize+1, (page-1)*pageSize))
+	rows := reflect.ValueOf(res).Elem()
+	rows.SetLen(0) // the rows are appended by List()
+	if err = p.List(res); err != nil {
+		return pi, err
+	}
+	if rows.Len() > pageSize {
+		rows.SetLen(pageSize)
+		pi.HasNext = true
+	}
+	return pi, nil
+}
+
+// the statement without ORDER BY, LIMIT and selected columns, GROUP BY is kept
+func (s *dbxStmt) countStmt() *dbxStmt {
+	c := *s
+	c.opts = nil
+	c.selection = ""
+	if fields := s.groupFields(); len(fields) > 0 {
+		c.opts = append(c.opts, GroupBy(fields...))
+	}
+	return &c
+}
+
+func (s *dbxStmt) groupFields() (fields []string) {
+	for _, b := range getOptions(s.opts...).bys {
+		if g, ok := b.(*groupBy); ok {
+			fields = append(fields, g.field...)
+		}
+	}
+	return
+}
+
+// SELECT COUNT(*) of the rows, or of the groups in a derived table if there's GROUP BY
+func (s *dbxStmt) countSQL() (string, []interface{}, error) {
+	c := s.countStmt()
+	fields := c.groupFields()
+	if len(fields) == 0 {
+		return c.SelectCols("COUNT(*)").ToSQL()
+	}
+	query, args, err := c.SelectCols(strings.Join(fields, ",")).ToSQL()
+	if err != nil {
+		return "", nil, err
+	}
+	return "SELECT COUNT(*) FROM (" + query + ") AS dbx_count", args, nil
+}
+
+func (s *dbxStmt) count() (int64, error) {
+	query, args, err := s.countSQL()
+	if err != nil {
+		return 0, err
+	}
+	stmt := s.engine.SqlStmt(s.table, query, append(s.options(), SqlArgs(args...))...)
+	if err = stmt.engine.checkConn(); err != nil {
+		return 0, err
+	}
+	if stmt.engine.IsDryRun() {
+		return 0, stmt.engine.logDryRun(stmt.ToSQL())
+	}
+	sess := stmt.queryStmt.createQuerySession(map[string]interface{}{_sql:stmt})
+	rows, err := sess.QuerySliceString()
+	if err != nil {
+		return 0, stmt.wrapError("count", err)
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return 0, nil
+	}
+	total, err := strconv.ParseInt(rows[0][0], 10, 64)
+	return total, stmt.wrapError("count", err)
+}
+
+// rows*filtered/100 of each table of the outer query in EXPLAIN are multiplied, the subqueries are skipped
+func (s *dbxStmt) estimatedCount() (int64, error) {
+	query, args, err := s.ToSQL()
+	if err != nil {
+		return 0, err
+	}
+	stmt := s.engine.SqlStmt(s.table, "EXPLAIN " + query, append(s.options(), SqlArgs(args...))...)
+	if err = stmt.engine.checkConn(); err != nil {
+		return 0, err
+	}
+	if stmt.engine.IsDryRun() {
+		return 0, stmt.engine.logDryRun(stmt.ToSQL())
+	}
+	sess := stmt.queryStmt.createQuerySession(map[string]interface{}{_sql:stmt})
+	rows, err := sess.QueryString()
+	if err != nil {
+		return 0, stmt.wrapError("count", err)
+	}
+	total, tables := float64(1), 0
+	for _, row := range rows {
+		if t := row["select_type"]; t != "SIMPLE" && t != "PRIMARY" {
+			continue
+		}
+		tables += 1
+		n, _ := strconv.ParseFloat(row["rows"], 64)
+		if filtered, err := strconv.ParseFloat(row["filtered"], 64); err == nil {
+			n = n * filtered / 100
+		}
+		total *= n
+	}
+	if tables == 0 {
+		return 0, nil
+	}
+	return int64(total + 0.5), nil
+}
@@ -0,0 +1,111 @@
+package dbx
+
+import (
+	"database/sql/driver"
+	"testing"
+	"strings"
+)
+
+func TestPaginate(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	s := db.XStmt().InnerJoin("user", "balance", "user.id=balance.user_id").Where(Gt("user.age", 10)).Desc("user.id").Limit(10, 20).SelectCols("user.*")
+	q, v, err := s.countSQL()
+	checkSQL(t, "count", q, v, err, "SELECT COUNT(*) FROM user INNER JOIN balance ON user.id=balance.user_id WHERE (user.age > ?)", 10)
+
+	q, v, err = db.XStmt("user").Where(Gt("age", 10)).GroupBy("name").Desc("name").Limit(10).countSQL()
+	checkSQL(t, "count-groups", q, v, err, "SELECT COUNT(*) FROM (SELECT name FROM user WHERE (`age` > ?) GROUP BY name) AS dbx_count", 10)
+
+	db.DryRun()
+	var users []sqlTestUser
+	pi, err := db.XStmt("user").Where(Gt("age", 10)).Desc("id").Paginate(2, 20, &users)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if pi != (PageInfo{Page: 2, PageSize: 20, HasPrev: true}) {
+		t.Fatalf("unexpected page info %+v", pi)
+	}
+	if pi, err = db.XStmt("user").Paginate(1, 20, &users, SkipCount()); err != nil || pi.Total != -1 || pi.Pages != -1 || pi.HasPrev {
+		t.Fatalf("unexpected page info %+v, %v", pi, err)
+	}
+	if pi, err = s.Paginate(1, 20, &users, EstimatedCount()); err != nil || !pi.Estimated {
+		t.Fatalf("unexpected page info %+v, %v", pi, err)
+	}
+	if _, err = db.XStmt("user").Paginate(0, 20, &users); err == nil {
+		t.Fatalf("error expected for page 0")
+	}
+	if _, err = db.XStmt("user").Paginate(1, 20, users); err == nil {
+		t.Fatalf("error expected for a non-pointer")
+	}
+}
+
+func TestPaginatePages(t *testing.T) {
+	var listed int
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT COUNT(*)"):
+			return stubRowsOf("count", []driver.Value{int64(45)})
+		case strings.HasPrefix(query, "EXPLAIN"):
+			return stubRowsOf("id,select_type,table,rows,filtered",
+				[]driver.Value{"1", "PRIMARY", "user", "1000", "50.00"},
+				[]driver.Value{"2", "DEPENDENT SUBQUERY", "orders", "100", "10.00"},
+			)
+		}
+		r := stubRowsOf("id,name,age")
+		for i:=1; i<=listed; i++ {
+			r.rows = append(r.rows, []driver.Value{int64(i), "john", int64(20)})
+		}
+		return r
+	})
+
+	var users []sqlTestUser
+	cases := []struct{
+		page int
+		listed int // the rows returned by the page query, which has one more row than the page size
+		expected PageInfo
+	}{
+		{1, 21, PageInfo{Page: 1, PageSize: 20, Total: 45, Pages: 3, HasNext: true}},
+		{2, 21, PageInfo{Page: 2, PageSize: 20, Total: 45, Pages: 3, HasNext: true, HasPrev: true}},
+		{3, 5, PageInfo{Page: 3, PageSize: 20, Total: 45, Pages: 3, HasPrev: true}},
+	}
+	for _, c := range cases {
+		listed = c.listed
+		pi, err := db.XStmt("user").Where(Gt("age", 10)).Desc("id").Paginate(c.page, 20, &users)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if pi != c.expected {
+			t.Fatalf("page %d: expected %+v, got %+v", c.page, c.expected, pi)
+		}
+		if n := c.listed; n > 20 && len(users) != 20 || n <= 20 && len(users) != n {
+			t.Fatalf("page %d: unexpected %d rows", c.page, len(users))
+		}
+	}
+
+	// the groups are counted
+	listed = 3
+	if _, err := db.XStmt("user").GroupBy("name").Paginate(1, 20, &users); err != nil {
+		t.Fatalf("%v", err)
+	}
+	stmts := stub.Stmts()
+	if q := stmts[len(stmts)-2]; q != "SELECT COUNT(*) FROM (SELECT name FROM user GROUP BY name) AS dbx_count" {
+		t.Fatalf("unexpected count query %q", q)
+	}
+
+	// the groups are counted exactly even if the count is estimated
+	pi, err := db.XStmt("user").GroupBy("name").Paginate(1, 20, &users, EstimatedCount())
+	if err != nil || pi.Total != 45 || pi.Estimated {
+		t.Fatalf("unexpected page info %+v, %v", pi, err)
+	}
+	stmts = stub.Stmts()
+	if q := stmts[len(stmts)-2]; q != "SELECT COUNT(*) FROM (SELECT name FROM user GROUP BY name) AS dbx_count" {
+		t.Fatalf("unexpected count query %q", q)
+	}
+
+	// only the outer query is estimated
+	pi, err = db.XStmt("user").Where(Exists(db.XStmt("orders").Where(EqX("orders.user_id", "user.id")))).Paginate(1, 20, &users, EstimatedCount())
+	if err != nil || pi.Total != 500 || pi.Pages != 25 || !pi.Estimated {
+		t.Fatalf("unexpected page info %+v, %v", pi, err)
+	}
+}
@@ -0,0 +1,69 @@
+// named db connections
+package dbx
+
+import (
+	"sync"
+	"fmt"
+)
+
+var (
+	registryLock = &sync.RWMutex{}
+	registry = map[string]*DBI{}
+)
+
+// register a db connection with a name, the first one registered becomes the default
+// connection used by the package-level helpers if there's no default connection.
+//  eg. db, _ := dbx.CreateMysqlInstance(dsn)
+//      dbx.Register("orders", db)
+//      dbx.Use("orders").XStmt("orders").Where(dbx.Eq("id", 1)).Get(&order)
+func Register(name string, db *DBI) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[name] = db
+	if DB == nil {
+		DB = db
+	}
+}
+
+// the connection is removed from the registry but not closed.
+func Unregister(name string) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	delete(registry, name)
+}
+
+// the connection registered with name, or an error if it is not found.
+func Lookup(name string) (*DBI, error) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	if db, ok := registry[name]; ok && db != nil {
+		return db, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoConnection, name)
+}
+
+// the connection registered with name. If it is not found, all statements created
+// with the returned DBI fail with ErrNoConnection, so do Ping() and Close().
+func Use(name string) *DBI {
+	db, err := Lookup(name)
+	if err != nil {
+		return &DBI{err: err}
+	}
+	return db
+}
+
+// make the connection registered with name the default one.
+func SetDefault(name string) error {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	db, ok := registry[name]
+	if !ok || db == nil {
+		return fmt.Errorf("%w: %s", ErrNoConnection, name)
+	}
+	DB = db
+	return nil
+}
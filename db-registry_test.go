@@ -0,0 +1,80 @@
+package dbx
+
+import (
+	"testing"
+	"context"
+	"strings"
+	"errors"
+	"sync"
+)
+
+func TestRegistry(t *testing.T) {
+	var user sqlTestUser
+	if _, err := Use("no-such-db").XStmt("user").Get(&user); !errors.Is(err, ErrNoConnection) {
+		t.Fatalf("ErrNoConnection expected, got %v", err)
+	}
+	if _, err := Lookup("no-such-db"); !errors.Is(err, ErrNoConnection) {
+		t.Fatalf("ErrNoConnection expected, got %v", err)
+	}
+	if err := SetDefault("no-such-db"); !errors.Is(err, ErrNoConnection) {
+		t.Fatalf("ErrNoConnection expected, got %v", err)
+	}
+	// the functions to set the default connection are named
+	if _, err := XStmt("user").Get(&user); !errors.Is(err, ErrNoConnection) || !strings.Contains(err.Error(), "CreateDriverDBInstance(...) with dbx.Register(...)") {
+		t.Fatalf("ErrNoConnection expected, got %v", err)
+	}
+
+	// no panic with the placeholder
+	noDB := Use("no-such-db")
+	if err := noDB.Ping(); !errors.Is(err, ErrNoConnection) {
+		t.Fatalf("ErrNoConnection expected, got %v", err)
+	}
+	if err := noDB.PingContext(context.Background()); !errors.Is(err, ErrNoConnection) {
+		t.Fatalf("ErrNoConnection expected, got %v", err)
+	}
+	if stats := noDB.PoolStats(); stats.OpenConnections != 0 {
+		t.Fatalf("no connection expected, got %d", stats.OpenConnections)
+	}
+	if err := noDB.Close(); !errors.Is(err, ErrNoConnection) {
+		t.Fatalf("ErrNoConnection expected, got %v", err)
+	}
+
+	db := newTestDB(t)
+	defer db.Close()
+	db.DryRun()
+
+	wg := &sync.WaitGroup{}
+	for i:=0; i<10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Register("orders", db)
+			Use("orders")
+		}()
+	}
+	wg.Wait()
+	defer Unregister("orders")
+
+	if d, err := Lookup("orders"); err != nil || d != db {
+		t.Fatalf("registered db expected, got %v, %v", d, err)
+	}
+	if _, err := Use("orders").XStmt("user").Get(&user); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := SetDefault("orders"); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer func() {
+		registryLock.Lock()
+		DB = nil
+		registryLock.Unlock()
+	}()
+	if _, err := XStmt("user").Get(&user); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	Unregister("orders")
+	if err := Use("orders").XStmt("user").List(&[]sqlTestUser{}); !errors.Is(err, ErrNoConnection) {
+		t.Fatalf("ErrNoConnection expected, got %v", err)
+	}
+}
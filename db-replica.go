@@ -0,0 +1,185 @@
+// read replicas
+package dbx
+
+import (
+	"github.com/rosbit/xorm"
+	"math/rand"
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// chooses one of the healthy replicas, the index of replicas is returned.
+type ReplicaPolicy func(replicas []*xorm.Engine) int
+
+// replicas are chosen in turn
+func RoundRobinPolicy() ReplicaPolicy {
+	var n uint64
+	return func(replicas []*xorm.Engine) int {
+		return int((atomic.AddUint64(&n, 1)-1) % uint64(len(replicas)))
+	}
+}
+
+func RandomPolicy() ReplicaPolicy {
+	return func(replicas []*xorm.Engine) int {
+		return rand.Intn(len(replicas))
+	}
+}
+
+// the replica with the least connections in use is chosen
+func LeastConnPolicy() ReplicaPolicy {
+	return func(replicas []*xorm.Engine) int {
+		idx, least := 0, -1
+		for i, r := range replicas {
+			if inUse := r.DB().Stats().InUse; least < 0 || inUse < least {
+				idx, least = i, inUse
+			}
+		}
+		return idx
+	}
+}
+
+const defaultHealthCheckInterval = 5*time.Second
+
+// reads are sent to the replicas, the primary DSN is given by CreateXXX().
+//  eg. CreateMysqlInstance(primaryDSN, dbx.Replicas(replicaDSN1, replicaDSN2), dbx.ReadPolicy(dbx.LeastConnPolicy()))
+func Replicas(dsn ...string) DBOption {
+	return func(opts *dbOptions) {
+		opts.replicas = append(opts.replicas, dsn...)
+	}
+}
+
+// RoundRobinPolicy() is used by default
+func ReadPolicy(policy ReplicaPolicy) DBOption {
+	return func(opts *dbOptions) {
+		opts.readPolicy = policy
+	}
+}
+
+// replicas are pinged every d, and those failed are removed from rotation until they are back.
+// <= 0 means no health check.
+func HealthCheckInterval(d time.Duration) DBOption {
+	return func(opts *dbOptions) {
+		opts.healthCheckInterval = d
+	}
+}
+
+type replica struct {
+	engine *xorm.Engine
+	down int32 // 1 if the replica failed to ping
+}
+
+type replicaSet struct {
+	replicas []*replica
+	policy ReplicaPolicy
+	done chan struct{}
+}
+
+func newReplicaSet(driverName string, opts *dbOptions) (*replicaSet, error) {
+	rs := &replicaSet{policy: opts.readPolicy}
+	if rs.policy == nil {
+		rs.policy = RoundRobinPolicy()
+	}
+	for _, dsn := range opts.replicas {
+		engine, err := xorm.NewEngine(driverName, dsn)
+		if err != nil {
+			rs.close()
+			return nil, err
+		}
+		if opts.debug {
+			engine.ShowSQL(true)
+		}
+		setPool(engine, opts)
+		rs.replicas = append(rs.replicas, &replica{engine: engine})
+	}
+	if opts.healthCheckInterval > 0 {
+		rs.done = make(chan struct{})
+		go healthCheck(rs.replicas, rs.done, opts.healthCheckInterval)
+	}
+	return rs, nil
+}
+
+// nil if all replicas are down
+func (rs *replicaSet) pick() *xorm.Engine {
+	engines := make([]*xorm.Engine, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		if atomic.LoadInt32(&r.down) == 0 {
+			engines = append(engines, r.engine)
+		}
+	}
+	if len(engines) == 0 {
+		return nil
+	}
+	i := rs.policy(engines)
+	if i < 0 || i >= len(engines) {
+		i = 0
+	}
+	return engines[i]
+}
+
+func healthCheck(replicas []*replica, done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			for i, r := range replicas {
+				var down int32
+				if err := r.engine.Ping(); err != nil {
+					down = 1
+				}
+				if atomic.SwapInt32(&r.down, down) != down {
+					if down == 1 {
+						r.engine.Logger().Warnf("[replica] #%d is down", i)
+					} else {
+						r.engine.Logger().Infof("[replica] #%d is back", i)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (rs *replicaSet) close() {
+	if rs.done != nil {
+		close(rs.done)
+		rs.done = nil
+	}
+	for _, r := range rs.replicas {
+		r.engine.Close()
+	}
+	rs.replicas = nil
+}
+
+// the engine to run a read, the primary is returned if there's no healthy replica,
+// or a write in ctx is not seen by the replica.
+func (db *DBI) readEngine(ctx context.Context) *xorm.Engine {
+	if engine := db.pickReplica(); engine != nil && !db.mustReadPrimary(ctx, engine) {
+		return engine
+	}
+	return db.Engine
+}
+
+func (db *DBI) pickReplica() *xorm.Engine {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.replicas == nil {
+		return nil
+	}
+	return db.replicas.pick()
+}
+
+func (db *DBI) hasReplicas() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.replicas != nil
+}
+
+// force reads of the statement to the primary
+func ReadPrimary() O {
+	return func(opts *Options) {
+		opts.readPrimary = true
+	}
+}
@@ -0,0 +1,106 @@
+package dbx
+
+import (
+	"github.com/rosbit/xorm"
+	"testing"
+	"context"
+	"sync"
+	"time"
+)
+
+func TestReplicaPolicies(t *testing.T) {
+	db, err := CreateMysqlInstance(GenerateMysqlDSN(DBName("test")),
+		Replicas(GenerateMysqlDSN(DBName("r1")), GenerateMysqlDSN(DBName("r2"))),
+		HealthCheckInterval(0),
+	)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer db.Close()
+
+	r1, r2 := db.replicas.replicas[0].engine, db.replicas.replicas[1].engine
+	for i, expected := range []*xorm.Engine{r1, r2, r1} {
+		if e := db.readEngine(context.Background()); e != expected {
+			t.Fatalf("round-robin #%d: replica %p expected, got %p", i, expected, e)
+		}
+	}
+
+	// unhealthy replicas are out of rotation
+	db.replicas.replicas[0].down = 1
+	for i:=0; i<3; i++ {
+		if e := db.readEngine(context.Background()); e != r2 {
+			t.Fatalf("the healthy replica expected, got %p", e)
+		}
+	}
+	db.replicas.replicas[1].down = 1
+	if e := db.readEngine(context.Background()); e != db.Engine {
+		t.Fatalf("the primary expected if all replicas are down, got %p", e)
+	}
+
+	engines := []*xorm.Engine{r1, r2}
+	if i := LeastConnPolicy()(engines); i != 0 {
+		t.Fatalf("the first one expected if no connection is in use, got %d", i)
+	}
+	for i:=0; i<10; i++ {
+		if i := RandomPolicy()(engines); i < 0 || i > 1 {
+			t.Fatalf("bad index %d", i)
+		}
+	}
+
+	if !db.XStmt("user").Primary().Table("user").primary {
+		t.Fatalf("Primary() should be kept after Table()")
+	}
+	if !db.ListStmt("user", nil, ReadPrimary()).readPrimary {
+		t.Fatalf("ReadPrimary() expected")
+	}
+}
+
+func TestReplicaHealthCheck(t *testing.T) {
+	db, err := CreateMysqlInstance(GenerateMysqlDSN(DBName("test")),
+		Replicas(GenerateMysqlDSN(Host("127.0.0.1", 1), DBName("test"), Attr("timeout", "100ms"))),
+		HealthCheckInterval(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer db.Close()
+
+	deadline := time.Now().Add(2*time.Second)
+	for db.readEngine(context.Background()) != db.Engine {
+		if time.Now().After(deadline) {
+			t.Fatalf("the unreachable replica should be removed from rotation")
+		}
+		time.Sleep(10*time.Millisecond)
+	}
+}
+
+func TestReplicaClose(t *testing.T) {
+	db, err := CreateMysqlInstance(GenerateMysqlDSN(DBName("test")),
+		Replicas(GenerateMysqlDSN(DBName("r1")), GenerateMysqlDSN(DBName("r2"))),
+		HealthCheckInterval(10*time.Millisecond),
+		ReadYourWrites(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// run with -race, picking replicas is safe while Close() drops them
+	var wg sync.WaitGroup
+	ctx := WithConsistency(context.Background())
+	for i:=0; i<4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j:=0; j<100; j++ {
+				db.pickReplica()
+				db.markWrite(ctx)
+			}
+		}()
+	}
+	db.Close()
+	wg.Wait()
+
+	if db.pickReplica() != nil || db.hasReplicas() {
+		t.Fatalf("no replica expected after Close()")
+	}
+}
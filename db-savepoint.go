@@ -0,0 +1,88 @@
+// savepoints in transactions
+package dbx
+
+import (
+	"runtime/debug"
+	"fmt"
+)
+
+// create a savepoint in the transaction, the name must be an identifier
+func (ts *TxStmt) Savepoint(name string) error {
+	return ts.execSavepoint("savepoint", "SAVEPOINT", name)
+}
+
+// undo the changes after the savepoint, the savepoint is kept
+func (ts *TxStmt) RollbackTo(name string) error {
+	return ts.execSavepoint("rollback to savepoint", "ROLLBACK TO SAVEPOINT", name)
+}
+
+func (ts *TxStmt) Release(name string) error {
+	return ts.execSavepoint("release savepoint", "RELEASE SAVEPOINT", name)
+}
+
+func (ts *TxStmt) execSavepoint(op string, stat string, name string) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("bad savepoint name %q", name)
+	}
+	if err := ts.engine.execTx(ts.session, fmt.Sprintf("%s `%s`", stat, name)); err != nil {
+		return wrapError(op, "", err)
+	}
+	return nil
+}
+
+// run fns in a savepoint. If any of them fails, only the changes of fns are rolled back,
+// and the error is returned, the transaction goes on if the caller ignores it.
+// a panic in fns is returned as *TxPanicError.
+//  eg. func optional_step(stmt *dbx.TxStmt) error {
+//          if err := stmt.Nested(step1, step2); err != nil {
+//              log.Printf("optional step skipped: %v", err)
+//          }
+//          return nil
+//      }
+func (ts *TxStmt) Nested(fns ...FnTxStmt) (err error) {
+	ts.savepoints += 1
+	name := fmt.Sprintf("dbx_nested_%d", ts.savepoints)
+	if err = ts.Savepoint(name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &TxPanicError{Value: r, Stack: debug.Stack()}
+			ts.engine.Logger().Errorf("panic in nested FnTxStmt: %v\n%s", r, err.(*TxPanicError).Stack)
+		}
+		if err == nil {
+			return
+		}
+		if rbErr := ts.RollbackTo(name); rbErr != nil {
+			err = &RollbackError{Err: err, RollbackErr: rbErr}
+			return
+		}
+		ts.Release(name)
+	}()
+
+	for _, fn := range fns {
+		if fn == nil {
+			continue
+		}
+		if err = ts.ctx.Err(); err != nil {
+			return err
+		}
+		if err = fn(ts); err != nil {
+			return err
+		}
+	}
+	return ts.Release(name)
+}
+
+func isIdentifier(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i:=0; i<len(name); i++ {
+		if !isNameChar(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
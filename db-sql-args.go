@@ -0,0 +1,110 @@
+package dbx
+
+import (
+	"reflect"
+	"strings"
+)
+
+// named arguments, a map[string]interface{} or a struct(pointer)
+type namedArgs struct {
+	arg interface{}
+}
+
+// bind ":name" in the SQL with arg, which is a map or a struct
+//  eg. dbx.Sql("user_id=:user_id", dbx.Named(map[string]interface{}{"user_id": 1}))
+func Named(arg interface{}) interface{} {
+	return &namedArgs{arg}
+}
+
+// args is returned as is if it is not a named argument,
+// otherwise ":name" in query is replaced with "?" and the values are returned in order.
+// the names not found in the named argument are left as is.
+func bindArgs(query string, args []interface{}) (string, []interface{}) {
+	if len(args) != 1 {
+		return query, args
+	}
+	named, ok := args[0].(*namedArgs)
+	if !ok {
+		return query, args
+	}
+
+	q := &strings.Builder{}
+	var vals []interface{}
+	var quote byte
+	for i:=0; i<len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			// "::" is not a name
+			q.WriteString("::")
+			i++
+			continue
+		case c == ':':
+			j := i+1
+			for j < len(query) && isNameChar(query[j], j == i+1) {
+				j++
+			}
+			if j > i+1 {
+				if v, found := named.lookup(query[i+1:j]); found {
+					q.WriteByte('?')
+					vals = append(vals, v)
+					i = j-1
+					continue
+				}
+			}
+		}
+		q.WriteByte(c)
+	}
+	return q.String(), vals
+}
+
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	default:
+		return false
+	}
+}
+
+// a name matches a map key exactly, or a struct field ignoring case and "_"
+func (n *namedArgs) lookup(name string) (interface{}, bool) {
+	v := reflect.Indirect(reflect.ValueOf(n.arg))
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		mv := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		if !mv.IsValid() {
+			return nil, false
+		}
+		return mv.Interface(), true
+	case reflect.Struct:
+		name = normalizeName(name)
+		t := v.Type()
+		for i:=0; i<t.NumField(); i++ {
+			f := t.Field(i)
+			if len(f.PkgPath) > 0 {
+				// unexported
+				continue
+			}
+			if normalizeName(f.Name) == name {
+				return v.Field(i).Interface(), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
@@ -0,0 +1,343 @@
+// render statements to SQL and args without executing them
+package dbx
+
+import (
+	"xorm.io/core"
+	"sync/atomic"
+	"reflect"
+	"strings"
+	"errors"
+	"fmt"
+)
+
+var (
+	errBeanRequired = errors.New("a bean is required to generate the SQL")
+	errTableRequired = errors.New("table name is required")
+	errSqlCond = errors.New("dbx.Sql() is a whole statement, use dbx.OnlyCond() for the conditions of UPDATE/DELETE")
+)
+
+// statements are rendered and logged, instead of being executed, when dry-run is on
+// BEGIN/COMMIT/ROLLBACK and savepoints of transactions are logged too.
+func (db *DBI) DryRun(dryRun ...bool) {
+	var on int32 = 1
+	if len(dryRun) > 0 && !dryRun[0] {
+		on = 0
+	}
+	atomic.StoreInt32(&db.dryRun, on)
+}
+
+func (db *DBI) IsDryRun() bool {
+	return db != nil && atomic.LoadInt32(&db.dryRun) == 1
+}
+
+func (db *DBI) logDryRun(query string, args []interface{}, err error) error {
+	if err != nil {
+		return err
+	}
+	db.Engine.Logger().Infof("[dry-run] %s %#v", query, args)
+	return nil
+}
+
+// --- query statements ---
+func (stmt *queryStmt) toSelectSQL(fields string, joinedElems []joinedElem, l limit) (string, []interface{}, error) {
+	if len(stmt.table) == 0 {
+		return "", nil, errTableRequired
+	}
+	sb := newSqlBuilder()
+	sb.appendSelect(fields, stmt.table, joinedElems, stmt.conds, stmt.bys, l)
+	query, args := sb.toSQL()
+	return query, args, nil
+}
+
+// the SQL run by Get(), with "LIMIT 1"
+func (stmt *queryStmt) ToSQL() (string, []interface{}, error) {
+	return stmt.toSelectSQL(stmt.selection, nil, &limitOffset{count:1})
+}
+
+func (stmt *listStmt) ToSQL() (string, []interface{}, error) {
+	return stmt.toSelectSQL(stmt.selection, nil, stmt.limit)
+}
+
+func (stmt *selectStmt) ToSQL() (string, []interface{}, error) {
+	return stmt.toSelectSQL(strings.Join(stmt.fields, ","), nil, stmt.limit)
+}
+
+func (stmt *sqlStmt) ToSQL() (string, []interface{}, error) {
+	return stmt.sql, stmt.args, nil
+}
+
+func (stmt *joinStmt) ToSQL() (string, []interface{}, error) {
+	return stmt.toSelectSQL(stmt.selectFields(), stmt.joinedElems, stmt.limit)
+}
+
+func (stmt *queryStmt) selectSQL(stat string) (string, []interface{}, error) {
+	return stmt.toSelectSQL(stat, nil, stmt.limit)
+}
+
+func (stmt *joinStmt) selectSQL(stat string) (string, []interface{}, error) {
+	return stmt.toSelectSQL(stat, stmt.joinedElems, stmt.limit)
+}
+
+// --- update/insert/delete statements ---
+func (stmt *updateSetStmt) ToSQL() (string, []interface{}, error) {
+	if len(stmt.table) == 0 {
+		return "", nil, errTableRequired
+	}
+	sb := newSqlBuilder()
+	fmt.Fprintf(sb.q, "UPDATE %s SET", stmt.table)
+	sb.appendSets(stmt.sets)
+	buildConds(sb, stmt.conds)
+	return sb.toWriteSQL()
+}
+
+func (stmt *rawUpdateStmt) ToSQL() (string, []interface{}, error) {
+	return stmt.sql, stmt.args, nil
+}
+
+// the columns to be updated are given by Cols(), or the non-zero fields of bean
+func (stmt *updateStmt) ToSQL(bean interface{}) (string, []interface{}, error) {
+	if len(stmt.table) == 0 {
+		return "", nil, errTableRequired
+	}
+	if bean == nil {
+		return "", nil, errBeanRequired
+	}
+	cols, vals, err := stmt.engine.beanColumns(bean, stmt.cols, true)
+	if err != nil {
+		return "", nil, err
+	}
+	sb := newSqlBuilder()
+	fmt.Fprintf(sb.q, "UPDATE %s SET", stmt.table)
+	sets := make([]Set, len(cols))
+	for i, col := range cols {
+		sets[i] = SetValue(col, vals[i])
+	}
+	sb.appendSets(sets)
+	buildConds(sb, stmt.conds)
+	return sb.toWriteSQL()
+}
+
+// bean is a struct pointer or a slice of structs
+func (stmt *insertStmt) ToSQL(bean interface{}) (string, []interface{}, error) {
+	if len(stmt.table) == 0 {
+		return "", nil, errTableRequired
+	}
+	sb := newSqlBuilder()
+	if _, err := stmt.engine.appendInsert(sb, stmt.table, bean); err != nil {
+		return "", nil, err
+	}
+	query, args := sb.toSQL()
+	return query, args, nil
+}
+
+// render "INSERT INTO ... VALUES ..." for a bean or a slice of beans, the inserted columns are returned
+func (db *DBI) appendInsert(sb *sqlBuilder, table string, bean interface{}) ([]string, error) {
+	if bean == nil {
+		return nil, errBeanRequired
+	}
+	beans := toBeans(bean)
+	if len(beans) == 0 {
+		return nil, errBeanRequired
+	}
+
+	var cols []string
+	for i, b := range beans {
+		c, vals, err := db.beanColumns(b, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			cols = c
+			fmt.Fprintf(sb.q, "INSERT INTO %s (%s) VALUES ", table, joinFields(cols, ""))
+		} else {
+			if len(c) != len(cols) {
+				return nil, fmt.Errorf("the columns of bean #%d are different from the first one", i)
+			}
+			sb.q.WriteString(",")
+		}
+		sb.q.WriteString("(")
+		for j, _ := range cols {
+			if j > 0 {
+				sb.q.WriteString(",")
+			}
+			sb.q.WriteString("?")
+		}
+		sb.q.WriteString(")")
+		sb.v = append(sb.v, vals...)
+	}
+	return cols, nil
+}
+
+// the update part of upsert is given by sets, or cols, or all inserted columns except the primary keys
+func (stmt *upsertStmt) ToSQL(bean interface{}) (string, []interface{}, error) {
+	if len(stmt.table) == 0 {
+		return "", nil, errTableRequired
+	}
+	sb := newSqlBuilder()
+	insertedCols, err := stmt.engine.appendInsert(sb, stmt.table, bean)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sets := stmt.sets
+	if len(sets) == 0 {
+		cols := stmt.cols
+		if len(cols) == 0 {
+			pks := map[string]bool{}
+			for _, pk := range stmt.engine.TableInfo(toBeans(bean)[0]).PrimaryKeys {
+				pks[pk] = true
+			}
+			for _, col := range insertedCols {
+				if !pks[col] {
+					cols = append(cols, col)
+				}
+			}
+		}
+		for _, col := range cols {
+			backquote := getQuote(col)
+			sets = append(sets, SetExpr(col, fmt.Sprintf("VALUES(%s%s%s)", backquote, col, backquote)))
+		}
+	}
+	if len(sets) == 0 {
+		return "", nil, errors.New("no column to update on duplicate key")
+	}
+	sb.q.WriteString(" ON DUPLICATE KEY UPDATE")
+	sb.appendSets(sets)
+	query, args := sb.toSQL()
+	return query, args, nil
+}
+
+// nil if bean is not a struct or there's no auto-increment column
+func (db *DBI) autoIncrColumn(bean interface{}) *core.Column {
+	if reflect.Indirect(reflect.ValueOf(bean)).Kind() != reflect.Struct {
+		return nil
+	}
+	table := db.TableInfo(bean)
+	if table == nil || table.Table == nil {
+		return nil
+	}
+	return table.AutoIncrColumn()
+}
+
+// elements of a slice are returned as pointers if they are structs
+func toBeans(bean interface{}) []interface{} {
+	v := reflect.Indirect(reflect.ValueOf(bean))
+	if v.Kind() != reflect.Slice {
+		return []interface{}{bean}
+	}
+	beans := make([]interface{}, v.Len())
+	for i:=0; i<v.Len(); i++ {
+		if e := v.Index(i); e.Kind() == reflect.Struct {
+			beans[i] = e.Addr().Interface()
+		} else {
+			beans[i] = e.Interface()
+		}
+	}
+	return beans
+}
+
+// the non-zero fields of the bean, which can be nil, are conditions too
+func (stmt *deleteStmt) ToSQL(bean interface{}) (string, []interface{}, error) {
+	if len(stmt.table) == 0 {
+		return "", nil, errTableRequired
+	}
+	conds := stmt.conds
+	if bean != nil {
+		cols, vals, err := stmt.engine.beanColumns(bean, nil, true)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append([]Cond{}, conds...)
+		for i, col := range cols {
+			conds = append(conds, Eq(col, vals[i]))
+		}
+	}
+	sb := newSqlBuilder()
+	fmt.Fprintf(sb.q, "DELETE FROM %s", stmt.table)
+	buildConds(sb, conds)
+	return sb.toWriteSQL()
+}
+
+// columns and values mapped from a bean. If cols is not empty, only the given columns are returned,
+// otherwise the auto-increment column is skipped if it is zero, and all zero fields are skipped if nonZero is true.
+func (db *DBI) beanColumns(bean interface{}, cols []string, nonZero bool) ([]string, []interface{}, error) {
+	if db == nil || db.Engine == nil {
+		return nil, nil, errors.New("no db engine to map the bean")
+	}
+	bv := reflect.Indirect(reflect.ValueOf(bean))
+	if bv.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("bean must be a struct, but %v given", bv.Kind())
+	}
+	table := db.TableInfo(bean)
+	if table == nil || table.Table == nil {
+		return nil, nil, fmt.Errorf("failed to map bean %T", bean)
+	}
+
+	var names []string
+	var vals []interface{}
+	if len(cols) > 0 {
+		for _, name := range cols {
+			col := table.GetColumn(name)
+			if col == nil {
+				return nil, nil, fmt.Errorf("column %s not found in %T", name, bean)
+			}
+			fv, err := col.ValueOfV(&bv)
+			if err != nil {
+				return nil, nil, err
+			}
+			names = append(names, col.Name)
+			vals = append(vals, fv.Interface())
+		}
+		return names, vals, nil
+	}
+
+	for _, col := range table.Columns() {
+		if col.MapType == core.ONLYFROMDB {
+			continue
+		}
+		fv, err := col.ValueOfV(&bv)
+		if err != nil {
+			return nil, nil, err
+		}
+		isZero := fv.IsZero()
+		if isZero && (nonZero || col.IsAutoIncrement) {
+			continue
+		}
+		names = append(names, col.Name)
+		vals = append(vals, fv.Interface())
+	}
+	return names, vals, nil
+}
+
+// the SQL run by List(), see UpdateSQL(), InsertSQL(), UpsertSQL() and DeleteSQL() for the others
+func (s *dbxStmt) ToSQL() (string, []interface{}, error) {
+	if stmt := s.generateJoinStmt(); stmt != nil {
+		return stmt.ToSQL()
+	} else if len(s.selection) > 0 {
+		return s.engine.SelectStmt(s.table, []string{s.selection}, s.conds, s.options()...).ToSQL()
+	}
+	return s.engine.ListStmt(s.table, s.conds, s.options()...).ToSQL()
+}
+
+// the SQL run by Update(vals)
+func (s *dbxStmt) UpdateSQL(vals interface{}) (string, []interface{}, error) {
+	if len(s.sets) == 0 {
+		return s.engine.UpdateStmt(s.table, s.conds, s.cols, s.options()...).ToSQL(vals)
+	}
+	return s.engine.UpdateSetStmt(s.table, s.sets, s.conds, s.options()...).ToSQL()
+}
+
+// the SQL run by Insert(vals)
+func (s *dbxStmt) InsertSQL(vals interface{}) (string, []interface{}, error) {
+	return s.engine.InsertStmt(s.table, s.options()...).ToSQL(vals)
+}
+
+// the SQL run by Upsert(vals, updateCols...)
+func (s *dbxStmt) UpsertSQL(vals interface{}, updateCols ...string) (string, []interface{}, error) {
+	return s.engine.UpsertStmt(s.table, updateCols, s.sets, s.options()...).ToSQL(vals)
+}
+
+// the SQL run by Delete(vals), or by DeleteWhere() if vals is nil
+func (s *dbxStmt) DeleteSQL(vals interface{}) (string, []interface{}, error) {
+	return s.engine.DeleteStmt(s.table, s.conds, s.options()...).ToSQL(vals)
+}
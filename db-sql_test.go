@@ -0,0 +1,342 @@
+package dbx
+
+import (
+	"database/sql/driver"
+	"database/sql"
+	"testing"
+	"strings"
+	"errors"
+	"time"
+	"fmt"
+)
+
+type sqlTestUser struct {
+	Id int `xorm:"pk autoincr"`
+	Name string
+	Age int
+}
+
+func newTestDB(t *testing.T) *DBI {
+	// no connection is made before executing statements
+	db, err := CreateMysqlInstance(GenerateMysqlDSN(DBName("test")))
+	if err != nil {
+		t.Fatalf("failed to create db instance: %v", err)
+	}
+	return db
+}
+
+func checkSQL(t *testing.T, name string, q string, v []interface{}, err error, expectedQ string, expectedV ...interface{}) {
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if q != expectedQ || fmt.Sprint(v...) != fmt.Sprint(expectedV...) {
+		t.Fatalf("%s: expected %q %v, got %q %v", name, expectedQ, expectedV, q, v)
+	}
+}
+
+func TestToSQL(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	q, v, err := db.XStmt("user").Where(Eq("name", "rosbit"), Gt("age", 10)).Desc("id").Limit(10, 20).ToSQL()
+	checkSQL(t, "list", q, v, err, "SELECT * FROM user WHERE (`name`=?) AND (`age` > ?) ORDER BY `id` DESC LIMIT 10 OFFSET 20", "rosbit", 10)
+
+	q, v, err = db.XStmt().InnerJoin("user", "userTag", "user.id=userTag.user_id").NextLeftJoin("tag", "userTag.tag_id=tag.id").Where(Eq("user.id", 1)).ToSQL()
+	checkSQL(t, "join", q, v, err, "SELECT user.*,userTag.*,tag.* FROM user INNER JOIN userTag ON user.id=userTag.user_id LEFT JOIN tag ON userTag.tag_id=tag.id WHERE (user.id=?)", 1)
+
+	q, v, err = db.QueryStmt("user", Where(Eq("id", 1))).ToSQL()
+	checkSQL(t, "get", q, v, err, "SELECT * FROM user WHERE (`id`=?) LIMIT 1", 1)
+
+	q, v, err = db.SelectStmt("user", Cols("id", "name"), Where(In("id", 1, 2)), GroupBy("name")).ToSQL()
+	checkSQL(t, "select", q, v, err, "SELECT id,name FROM user WHERE (`id` IN (?,?)) GROUP BY name", 1, 2)
+
+	q, v, err = db.UpdateSetStmt("user", Sets(SetValue("name", "john"), SetExpr("age", "age+1")), Where(Eq("id", 1))).ToSQL()
+	checkSQL(t, "update-set", q, v, err, "UPDATE user SET `name`=?,`age`=age+1 WHERE (`id`=?)", "john", 1)
+
+	q, v, err = db.UpdateStmt("user", Where(Eq("id", 1)), Cols("name")).ToSQL(&sqlTestUser{Id:1, Name:"john", Age:10})
+	checkSQL(t, "update-cols", q, v, err, "UPDATE user SET `name`=? WHERE (`id`=?)", "john", 1)
+
+	q, v, err = db.UpdateStmt("user", Where(Eq("id", 1)), nil).ToSQL(&sqlTestUser{Name:"john"})
+	checkSQL(t, "update-non-zero", q, v, err, "UPDATE user SET `name`=? WHERE (`id`=?)", "john", 1)
+
+	q, v, err = db.InsertStmt("user").ToSQL(&sqlTestUser{Name:"john", Age:10})
+	checkSQL(t, "insert", q, v, err, "INSERT INTO user (`name`,`age`) VALUES (?,?)", "john", 10)
+
+	q, v, err = db.InsertStmt("user").ToSQL([]sqlTestUser{{Name:"john", Age:10}, {Name:"rosbit", Age:20}})
+	checkSQL(t, "insert-multi", q, v, err, "INSERT INTO user (`name`,`age`) VALUES (?,?),(?,?)", "john", 10, "rosbit", 20)
+
+	q, v, err = db.DeleteStmt("user", Where(Lt("age", 10))).ToSQL(&sqlTestUser{Name:"john"})
+	checkSQL(t, "delete", q, v, err, "DELETE FROM user WHERE (`age` < ?) AND (`name`=?)", 10, "john")
+
+	q, v, err = db.SqlStmt("user", "select * from user where id=:id", SqlArgs(Named(map[string]int{"id": 1}))).ToSQL()
+	checkSQL(t, "sql", q, v, err, "select * from user where id=?", 1)
+
+	q, v, err = db.UpsertStmt("user", nil, nil).ToSQL(&sqlTestUser{Id:1, Name:"john", Age:10})
+	checkSQL(t, "upsert", q, v, err, "INSERT INTO user (`id`,`name`,`age`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`age`=VALUES(`age`)", 1, "john", 10)
+
+	q, v, err = db.UpsertStmt("user", Cols("age"), nil).ToSQL([]*sqlTestUser{{Id:1, Name:"john", Age:10}, {Id:2, Name:"rosbit", Age:20}})
+	checkSQL(t, "upsert-multi", q, v, err, "INSERT INTO user (`id`,`name`,`age`) VALUES (?,?,?),(?,?,?) ON DUPLICATE KEY UPDATE `age`=VALUES(`age`)", 1, "john", 10, 2, "rosbit", 20)
+
+	q, v, err = db.UpsertStmt("user", nil, Sets(SetExpr("age", "age+VALUES(age)"), SetValue("name", "x"))).ToSQL(&sqlTestUser{Id:1, Name:"john", Age:10})
+	checkSQL(t, "upsert-sets", q, v, err, "INSERT INTO user (`id`,`name`,`age`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `age`=age+VALUES(age),`name`=?", 1, "john", 10, "x")
+
+	q, v, err = db.DeleteStmt("user", Where(Lt("age", 10), IsNull("name"))).ToSQL(nil)
+	checkSQL(t, "delete-where", q, v, err, "DELETE FROM user WHERE (`age` < ?) AND (`name` IS NULL)", 10)
+
+	if _, _, err = db.InsertStmt("user").ToSQL(nil); err == nil {
+		t.Fatalf("insert without bean is expected to fail")
+	}
+
+	x := db.XStmt("user").Where(Eq("id", 1))
+	q, v, err = x.UpdateSQL(&sqlTestUser{Name:"john"})
+	checkSQL(t, "x-update", q, v, err, "UPDATE user SET `name`=? WHERE (`id`=?)", "john", 1)
+
+	q, v, err = db.XStmt("user").Where(Eq("id", 1)).Cols("age").UpdateSQL(&sqlTestUser{Name:"john", Age:10})
+	checkSQL(t, "x-update-cols", q, v, err, "UPDATE user SET `age`=? WHERE (`id`=?)", 10, 1)
+
+	q, v, err = db.XStmt("user").Set(SetExpr("age", "age+1")).Where(Eq("id", 1)).UpdateSQL(nil)
+	checkSQL(t, "x-update-set", q, v, err, "UPDATE user SET `age`=age+1 WHERE (`id`=?)", 1)
+
+	q, v, err = db.XStmt("user").InsertSQL(&sqlTestUser{Name:"john", Age:10})
+	checkSQL(t, "x-insert", q, v, err, "INSERT INTO user (`name`,`age`) VALUES (?,?)", "john", 10)
+
+	q, v, err = db.XStmt("user").UpsertSQL(&sqlTestUser{Id:1, Name:"john", Age:10}, "age")
+	checkSQL(t, "x-upsert", q, v, err, "INSERT INTO user (`id`,`name`,`age`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `age`=VALUES(`age`)", 1, "john", 10)
+
+	q, v, err = db.XStmt("user").Where(Lt("age", 10)).DeleteSQL(nil)
+	checkSQL(t, "x-delete", q, v, err, "DELETE FROM user WHERE (`age` < ?)", 10)
+
+	q, v, err = db.XStmt("user").Where(Lt("age", 10)).DeleteSQL(&sqlTestUser{Name:"john"})
+	checkSQL(t, "x-delete-bean", q, v, err, "DELETE FROM user WHERE (`age` < ?) AND (`name`=?)", 10, "john")
+}
+
+// ToSQL() renders what the xorm session runs
+func TestSqlCond(t *testing.T) {
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		return stubRowsOf("id,name,age")
+	})
+
+	s := db.XStmt("user").Where(Sql("select id,name from user where age>?", 10))
+	q, v, err := s.ToSQL()
+	checkSQL(t, "sql", q, v, err, "select id,name from user where age>?", 10)
+	var users []sqlTestUser
+	if err = s.List(&users); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if stmts := stub.Stmts(); len(stmts) != 1 || stmts[0] != q {
+		t.Fatalf("%q expected to be run, got %q", q, stmts)
+	}
+
+	// not a condition of UPDATE/DELETE
+	if _, _, err = db.XStmt("user").Set(SetValue("age", 1)).Where(Sql("select 1")).UpdateSQL(nil); err != errSqlCond {
+		t.Fatalf("errSqlCond expected, got %v", err)
+	}
+	if _, _, err = db.XStmt("user").Where(Sql("select 1")).DeleteSQL(nil); err != errSqlCond {
+		t.Fatalf("errSqlCond expected, got %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	db.DryRun()
+
+	// nothing is sent to the db
+	var users []sqlTestUser
+	if err := db.XStmt("user").Where(Eq("name", "rosbit")).List(&users); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if _, err := db.XStmt("user").Set(SetExpr("age", "age+1")).Where(Eq("id", 1)).Update(nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := db.XStmt("user").Insert(&sqlTestUser{Name:"john"}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if _, err := db.XStmt("user").Where(Eq("id", 1)).Count(&sqlTestUser{}); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	ch, stop := db.XStmt("user").Iter(&sqlTestUser{})
+	for range ch {
+		t.Fatalf("nothing expected in dry-run mode")
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("iter: %v", err)
+	}
+}
+
+func TestDryRunTx(t *testing.T) {
+	db, stub := newStubDB(t, nil)
+	db.DryRun()
+
+	update := func(stmt *TxStmt) error {
+		_, err := stmt.Table("user").Set(SetExpr("age", "age+1")).Where(Eq("id", 1)).Update(nil)
+		return err
+	}
+	nested := func(stmt *TxStmt) error {
+		return stmt.Nested(update)
+	}
+	fail := func(stmt *TxStmt) error {
+		return errors.New("failed")
+	}
+	if err := db.Tx(TxStmts(update, nested), TxIsolation(sql.LevelSerializable), TxReadOnly()); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := db.Tx(TxStmts(update, fail)); err == nil || err.Error() != "failed" {
+		t.Fatalf("the error of FnTxStmt expected, got %v", err)
+	}
+	if stmts := stub.Stmts(); len(stmts) > 0 {
+		t.Fatalf("nothing expected to be sent in dry-run mode, got %q", stmts)
+	}
+
+	// toggled while statements are running
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i:=0; i<100; i++ {
+			db.DryRun(i%2 == 0)
+		}
+	}()
+	for i:=0; i<100; i++ {
+		db.IsDryRun()
+	}
+	<-done
+}
+
+func TestSafeWrites(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	db.DryRun()
+
+	if _, err := db.XStmt("user").Set(SetValue("age", 1)).Update(nil); !errors.Is(err, ErrUnsafeStatement) {
+		t.Fatalf("UPDATE without WHERE is expected to be rejected, got %v", err)
+	}
+	if _, err := db.XStmt("user").Cols("age").Update(&sqlTestUser{Age:1}); !errors.Is(err, ErrUnsafeStatement) {
+		t.Fatalf("UPDATE without WHERE is expected to be rejected, got %v", err)
+	}
+	if _, err := db.XStmt("user").DeleteWhere(); !errors.Is(err, ErrUnsafeStatement) {
+		t.Fatalf("DELETE without WHERE is expected to be rejected, got %v", err)
+	}
+	if _, err := db.XStmt("user").Where(And()).DeleteWhere(); !errors.Is(err, ErrUnsafeStatement) {
+		t.Fatalf("empty conditions are expected to be rejected, got %v", err)
+	}
+
+	if _, err := db.XStmt("user").Set(SetValue("age", 1)).AllRows().Update(nil); err != nil {
+		t.Fatalf("UPDATE with AllRows(): %v", err)
+	}
+	if _, err := db.XStmt("user").Delete(&sqlTestUser{Id:1}); err != nil {
+		t.Fatalf("DELETE with a bean: %v", err)
+	}
+	if _, err := db.XStmt("user").Where(Eq("id", 1)).DeleteWhere(); err != nil {
+		t.Fatalf("DELETE with WHERE: %v", err)
+	}
+
+	// dbx.Sql() is not a WHERE, it's rejected even with AllRows() or without safe writes
+	safeDB, stub := newStubDB(t, nil)
+	for name, s := range map[string]*dbxStmt{
+		"update-set": safeDB.XStmt("user").Set(SetValue("age", 1)).Where(Sql("select 1")),
+		"update-set-all": safeDB.XStmt("user").Set(SetValue("age", 1)).Where(Sql("select 1")).AllRows(),
+		"update-bean": safeDB.XStmt("user").Cols("age").Where(Sql("select 1")),
+		"delete": safeDB.XStmt("user").Where(Sql("select 1")),
+	} {
+		var err error
+		switch name {
+		case "update-set", "update-set-all":
+			_, err = s.Update(nil)
+		case "update-bean":
+			_, err = s.Update(&sqlTestUser{Age:1})
+		default:
+			_, err = s.DeleteWhere()
+		}
+		if !errors.Is(err, errSqlCond) {
+			t.Fatalf("%s: errSqlCond expected, got %v", name, err)
+		}
+	}
+	if stmts := stub.Stmts(); len(stmts) > 0 {
+		t.Fatalf("nothing expected to be run, got %q", stmts)
+	}
+
+	unsafeDB, err := CreateMysqlInstance(GenerateMysqlDSN(DBName("test")), SafeWrites(false))
+	if err != nil {
+		t.Fatalf("failed to create db instance: %v", err)
+	}
+	defer unsafeDB.Close()
+	unsafeDB.DryRun()
+	if _, err := unsafeDB.XStmt("user").DeleteWhere(); err != nil {
+		t.Fatalf("DELETE without WHERE is expected to be allowed: %v", err)
+	}
+	if _, err := unsafeDB.XStmt("user").Where(Sql("select 1")).DeleteWhere(); !errors.Is(err, errSqlCond) {
+		t.Fatalf("errSqlCond expected, got %v", err)
+	}
+}
+
+func TestPoolOptions(t *testing.T) {
+	db, err := CreateMysqlInstance(GenerateMysqlDSN(DBName("test")), MaxOpenConns(50), MaxIdleConns(5), ConnMaxLifetime(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create db instance: %v", err)
+	}
+	defer db.Close()
+	if stats := db.PoolStats(); stats.MaxOpenConnections != 50 {
+		t.Fatalf("expected max open connections 50, got %d", stats.MaxOpenConnections)
+	}
+
+	// MaxIdleConns(0) is applied, instead of keeping the default of database/sql
+	for n, options := range map[int][]DBOption{1: nil, 0: {MaxIdleConns(0)}} {
+		db, _ := newStubDB(t, nil, options...)
+		if _, err := db.Exec("DELETE FROM user"); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if idle := db.PoolStats().Idle; idle != n {
+			t.Fatalf("expected %d idle connections, got %d", n, idle)
+		}
+	}
+}
+
+func TestInsertWithResult(t *testing.T) {
+	lockMode := "1"
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		switch {
+		case strings.HasPrefix(query, "INSERT"):
+			return stubResult{lastInsertId: 7, affected: int64(strings.Count(query, "(?")) }
+		case strings.Contains(query, "LAST_INSERT_ID()"):
+			return stubRowsOf("id,step,mode", []driver.Value{"7", "2", lockMode})
+		}
+		return stubResult{}
+	})
+
+	user := &sqlTestUser{Name:"john"}
+	res, err := db.XStmt("user").InsertWithResult(user)
+	if err != nil || user.Id != 7 || res.RowsAffected != 1 || res.FirstInsertId != 7 || res.LastInsertId != 7 {
+		t.Fatalf("single bean: unexpected %#v %#v %v", user, res, err)
+	}
+
+	users := []sqlTestUser{{Name:"john"}, {Name:"rosbit"}, {Name:"tom"}}
+	res, err = db.XStmt("user").InsertWithResult(users)
+	if err != nil || res.RowsAffected != 3 || res.FirstInsertId != 7 || res.LastInsertId != 11 {
+		t.Fatalf("slice: unexpected %#v %v", res, err)
+	}
+	for i, u := range users {
+		if u.Id != 7+2*i {
+			t.Fatalf("slice: unexpected id of #%d: %d", i, u.Id)
+		}
+	}
+
+	// the ids may interleave with other inserts
+	lockMode = "2"
+	users = []sqlTestUser{{Name:"john"}, {Name:"rosbit"}}
+	res, err = db.XStmt("user").InsertWithResult(users)
+	if err != nil || res.RowsAffected != 2 || res.FirstInsertId != 7 || res.LastInsertId != 0 || users[0].Id != 0 || users[1].Id != 0 {
+		t.Fatalf("interleaved: unexpected %#v %#v %v", users, res, err)
+	}
+
+	lockMode = "1"
+	users = []sqlTestUser{{Id:5, Name:"john"}, {Name:"rosbit"}}
+	res, err = db.XStmt("user").InsertWithResult(users)
+	if err != nil || res.FirstInsertId != 0 || res.LastInsertId != 0 || users[0].Id != 5 || users[1].Id != 0 {
+		t.Fatalf("explicit id: unexpected %#v %#v %v", users, res, err)
+	}
+
+	stmts := stub.Stmts()
+	if len(stmts) == 0 || stmts[len(stmts)-1] != "COMMIT" {
+		t.Fatalf("the insert of a slice is expected to be committed: %q", stmts)
+	}
+}
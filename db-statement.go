@@ -1,7 +1,10 @@
 package dbx
 
 import (
+	"github.com/rosbit/xorm"
 	"database/sql"
+	"context"
+	"strconv"
 	"strings"
 	"fmt"
 )
@@ -17,15 +20,39 @@ type execStmt struct {
 	session *Session
 	table   string
 	conds   []Cond
+	ctx     context.Context
 }
 
-func (stmt *execStmt) createExecSession(extraQuery ...map[string]interface{}) *Session {
+func (stmt *execStmt) newSession() *Session {
+	return stmt.newSessionOn(stmt.engine.Engine)
+}
+
+// the session given by WithSession() is used if there's one
+func (stmt *execStmt) newSessionOn(engine *xorm.Engine) *Session {
 	var sess *Session
 	if stmt.session == nil {
-		sess = stmt.engine.Table(stmt.table)
+		sess = engine.Table(stmt.table)
 	} else {
 		sess = stmt.session.Table(stmt.table)
 	}
+	if stmt.ctx != nil {
+		sess = sess.Context(stmt.ctx)
+	}
+	return sess
+}
+
+func (stmt *execStmt) context() context.Context {
+	if stmt.ctx == nil {
+		return context.Background()
+	}
+	return stmt.ctx
+}
+
+func (stmt *execStmt) createExecSession(extraQuery ...map[string]interface{}) *Session {
+	return stmt.buildSession(stmt.newSession(), extraQuery...)
+}
+
+func (stmt *execStmt) buildSession(sess *Session, extraQuery ...map[string]interface{}) *Session {
 	if len(extraQuery) > 0 {
 		for k, v := range extraQuery[0] {
 			switch k {
@@ -34,21 +61,12 @@ func (stmt *execStmt) createExecSession(extraQuery ...map[string]interface{}) *S
 					sess.Select(strings.Join(fields, ","))
 				}
 			case _sql:
-				if sql, ok := v.(string); ok {
-					sess.SQL(sql)
+				if sStmt, ok := v.(*sqlStmt); ok {
+					sess.SQL(sStmt.sql, sStmt.args...)
 				}
 			case _join:
 				jStmt := v.(*joinStmt)
-				if len(jStmt.selection) == 0 {
-					tbls := make([]string, len(jStmt.joinedElems)+1)
-					tbls[0] = fmt.Sprintf("%s.*", stmt.table)
-					for i, e := range jStmt.joinedElems {
-						tbls[i+1] = fmt.Sprintf("%s.*", e.joinedTbl)
-					}
-					sess = sess.Select(strings.Join(tbls, ","))
-				} else {
-					sess = sess.Select(jStmt.selection)
-				}
+				sess = sess.Select(jStmt.selectFields())
 				for _, e := range jStmt.joinedElems {
 					sess.Join(e.joinType, e.joinedTbl, e.joinCond)
 				}
@@ -66,6 +84,56 @@ func (stmt *execStmt) createExecSession(extraQuery ...map[string]interface{}) *S
 	return sess
 }
 
+func (stmt *execStmt) wrapError(op string, err error) error {
+	return wrapError(op, stmt.table, err)
+}
+
+// a successful write is remembered by the consistency token of the context, unless it is in a session.
+func (stmt *execStmt) wrote(err error) error {
+	if err == nil && stmt.session == nil {
+		stmt.engine.markWrite(stmt.ctx)
+	}
+	return err
+}
+
+func (stmt *execStmt) affected(op string, r sql.Result, err error) (StmtResult, error) {
+	if err != nil {
+		return int64(0), stmt.wrapError(op, err)
+	}
+	stmt.wrote(nil)
+	if r == nil {
+		return int64(0), nil
+	}
+	ac, err := r.RowsAffected()
+	return ac, stmt.wrapError(op, err)
+}
+
+// ErrUnsafeStatement is returned if no condition is given when safe writes is on.
+// the non-zero fields of bean are conditions of DELETE. dbx.Sql() is not a condition of UPDATE/DELETE.
+func (stmt *execStmt) checkSafeWrite(op string, bean interface{}) error {
+	sb := newSqlBuilder()
+	allRows := false
+	for _, c := range stmt.conds {
+		if _, ok := c.(*allRowsCond); ok {
+			allRows = true
+			continue
+		}
+		c.makeCond(sb)
+	}
+	if sb.raw != nil {
+		return stmt.wrapError(op, errSqlCond)
+	}
+	if allRows || sb.hasWhere || stmt.engine == nil || !stmt.engine.safeWrites {
+		return nil
+	}
+	if bean != nil && op == "delete" {
+		if cols, _, err := stmt.engine.beanColumns(bean, nil, true); err == nil && len(cols) > 0 {
+			return nil
+		}
+	}
+	return stmt.wrapError(op, ErrUnsafeStatement)
+}
+
 func (stmt *execStmt) setSession(session *Session) {
 	if stmt.session == nil {
 		stmt.session = session
@@ -77,14 +145,27 @@ type queryStmt struct {
 	bys []by
 	limit limit
 	selection string
+	readPrimary bool
 }
 func (stmt *queryStmt) Exec(bean interface{}) (StmtResult, error) {
+	if err := stmt.engine.checkConn(); err != nil {
+		return false, err
+	}
+	if stmt.engine.IsDryRun() {
+		return false, stmt.engine.logDryRun(stmt.ToSQL())
+	}
 	sess := stmt.createQuerySession()
-	return sess.Get(bean)
+	has, err := sess.Get(bean)
+	return has, stmt.wrapError("get", err)
 }
 
+// reads are sent to a replica unless they are in a session, or forced to the primary
 func (stmt *queryStmt) createQuerySession(extraQuery ...map[string]interface{}) *Session {
-	sess := stmt.execStmt.createExecSession(extraQuery...)
+	engine := stmt.engine.Engine
+	if !stmt.readPrimary {
+		engine = stmt.engine.readEngine(stmt.ctx)
+	}
+	sess := stmt.execStmt.buildSession(stmt.newSessionOn(engine), extraQuery...)
 
 	for _, b := range stmt.bys {
 		sess = b.makeBy(sess)
@@ -100,13 +181,19 @@ type listStmt struct {
 	*queryStmt
 }
 func (stmt *listStmt) Exec(bean interface{}) (StmtResult, error) {
+	if err := stmt.engine.checkConn(); err != nil {
+		return nil, err
+	}
+	if stmt.engine.IsDryRun() {
+		return nil, stmt.engine.logDryRun(stmt.ToSQL())
+	}
 	sess := stmt.queryStmt.createQuerySession()
 	return stmt.find(sess, bean)
 }
 
 func (stmt *listStmt) find(sess *Session, bean interface{}) (StmtResult, error) {
 	err := sess.Find(bean)
-	return nil, err
+	return nil, stmt.wrapError("list", err)
 }
 
 type selectStmt struct {
@@ -114,6 +201,12 @@ type selectStmt struct {
 	fields []string
 }
 func (stmt *selectStmt) Exec(bean interface{}) (StmtResult, error) {
+	if err := stmt.engine.checkConn(); err != nil {
+		return nil, err
+	}
+	if stmt.engine.IsDryRun() {
+		return nil, stmt.engine.logDryRun(stmt.ToSQL())
+	}
 	sess := stmt.queryStmt.createQuerySession(map[string]interface{}{_select:stmt.fields})
 	return stmt.find(sess, bean)
 }
@@ -121,9 +214,16 @@ func (stmt *selectStmt) Exec(bean interface{}) (StmtResult, error) {
 type sqlStmt struct {
 	*listStmt
 	sql string
+	args []interface{}
 }
 func (stmt *sqlStmt) Exec(bean interface{}) (StmtResult, error) {
-	sess := stmt.queryStmt.createQuerySession(map[string]interface{}{_sql:stmt.sql})
+	if err := stmt.engine.checkConn(); err != nil {
+		return nil, err
+	}
+	if stmt.engine.IsDryRun() {
+		return nil, stmt.engine.logDryRun(stmt.ToSQL())
+	}
+	sess := stmt.queryStmt.createQuerySession(map[string]interface{}{_sql:stmt})
 	return stmt.find(sess, bean)
 }
 
@@ -136,12 +236,29 @@ type joinStmt struct {
 	*listStmt
 	joinedElems []joinedElem
 }
+func (stmt *joinStmt) selectFields() string {
+	if len(stmt.selection) > 0 {
+		return stmt.selection
+	}
+	tbls := make([]string, len(stmt.joinedElems)+1)
+	tbls[0] = fmt.Sprintf("%s.*", stmt.table)
+	for i, e := range stmt.joinedElems {
+		tbls[i+1] = fmt.Sprintf("%s.*", e.joinedTbl)
+	}
+	return strings.Join(tbls, ",")
+}
 func (stmt *joinStmt) createQuerySession() *Session {
 	return stmt.queryStmt.createQuerySession(map[string]interface{}{
 		_join: stmt,
 	})
 }
 func (stmt *joinStmt) Exec(bean interface{}) (StmtResult, error) {
+	if err := stmt.engine.checkConn(); err != nil {
+		return nil, err
+	}
+	if stmt.engine.IsDryRun() {
+		return nil, stmt.engine.logDryRun(stmt.ToSQL())
+	}
 	sess := stmt.createQuerySession()
 	return stmt.find(sess, bean)
 }
@@ -151,31 +268,42 @@ type updateStmt struct {
 	cols []string
 }
 func (stmt *updateStmt) Exec(bean interface{}) (StmtResult, error) {
+	if err := stmt.checkSafeWrite("update", bean); err != nil {
+		return int64(0), err
+	}
+	if err := stmt.engine.checkConn(); err != nil {
+		return int64(0), err
+	}
+	if stmt.engine.IsDryRun() {
+		return int64(0), stmt.engine.logDryRun(stmt.ToSQL(bean))
+	}
 	sess := stmt.execStmt.createExecSession()
 	if len(stmt.cols) > 0 {
 		sess = sess.Cols(stmt.cols...)
 	}
-	return sess.Update(bean)
+	ac, err := sess.Update(bean)
+	return ac, stmt.wrote(stmt.wrapError("update", err))
 }
 
 type rawUpdateStmt struct {
 	*execStmt
 	sql string
+	args []interface{}
 }
 func (stmt *rawUpdateStmt) Exec(_ interface{}) (StmtResult, error) {
 	if len(stmt.table) == 0 {
 		return int64(0), nil
 	}
-
-	sess := stmt.execStmt.createExecSession()
-	r, err := sess.Exec(stmt.sql)
-	if err != nil {
+	if err := stmt.engine.checkConn(); err != nil {
 		return int64(0), err
 	}
-	if r1, ok := r.(sql.Result); ok {
-		return r1.RowsAffected()
+	if stmt.engine.IsDryRun() {
+		return int64(0), stmt.engine.logDryRun(stmt.ToSQL())
 	}
-	return int64(0), nil
+
+	sess := stmt.execStmt.createExecSession()
+	r, err := sess.Exec(append([]interface{}{stmt.sql}, stmt.args...)...)
+	return stmt.affected("exec", r, err)
 }
 
 type updateSetStmt struct {
@@ -186,45 +314,201 @@ func (stmt *updateSetStmt) Exec(bean interface{}) (StmtResult, error) {
 	if len(stmt.sets) == 0 || len(stmt.table) == 0 {
 		return int64(0), nil
 	}
-
-	sb := newSqlBuilder()
-	fmt.Fprintf(sb.q, "UPDATE %s SET", stmt.table)
-	sb.appendSets(stmt.sets)
-	if len(stmt.conds) > 0 {
-		sb.q.WriteString(" WHERE")
-		buildConds(sb, stmt.conds)
+	if err := stmt.checkSafeWrite("update", nil); err != nil {
+		return int64(0), err
 	}
-	params := sb.toParams()
 
-	var sess *Session
-	if stmt.session == nil {
-		sess = stmt.engine.Table(stmt.table)
-	} else {
-		sess = stmt.session.Table(stmt.table)
-	}
-	r, err := sess.Exec(params...)
+	query, args, err := stmt.ToSQL()
 	if err != nil {
 		return int64(0), err
 	}
-	if r1, ok := r.(sql.Result); ok {
-		return r1.RowsAffected()
+	if err := stmt.engine.checkConn(); err != nil {
+		return int64(0), err
+	}
+	if stmt.engine.IsDryRun() {
+		return int64(0), stmt.engine.logDryRun(query, args, nil)
 	}
-	return int64(0), nil
+
+	sess := stmt.newSession()
+	r, err := sess.Exec(append([]interface{}{query}, args...)...)
+	return stmt.affected("update", r, err)
 }
 
 type insertStmt struct {
 	*execStmt
 }
 func (stmt *insertStmt) Exec(bean interface{}) (StmtResult, error) {
+	if err := stmt.engine.checkConn(); err != nil {
+		return int64(0), err
+	}
+	if stmt.engine.IsDryRun() {
+		return int64(0), stmt.engine.logDryRun(stmt.ToSQL(bean))
+	}
 	stmt.conds = nil
 	sess := stmt.execStmt.createExecSession()
-	return sess.Insert(bean)
+	ac, err := sess.Insert(bean)
+	return ac, stmt.wrote(stmt.wrapError("insert", err))
+}
+
+// INSERT ... ON DUPLICATE KEY UPDATE ...
+type upsertStmt struct {
+	*execStmt
+	cols []string
+	sets []Set
+}
+func (stmt *upsertStmt) Exec(bean interface{}) (StmtResult, error) {
+	query, args, err := stmt.ToSQL(bean)
+	if err != nil {
+		return int64(0), err
+	}
+	if err := stmt.engine.checkConn(); err != nil {
+		return int64(0), err
+	}
+	if stmt.engine.IsDryRun() {
+		return int64(0), stmt.engine.logDryRun(query, args, nil)
+	}
+
+	sess := stmt.newSession()
+	r, err := sess.Exec(append([]interface{}{query}, args...)...)
+	return stmt.affected("upsert", r, err)
 }
 
 type deleteStmt struct {
 	*execStmt
 }
 func (stmt *deleteStmt) Exec(bean interface{}) (StmtResult, error) {
+	if err := stmt.checkSafeWrite("delete", bean); err != nil {
+		return int64(0), err
+	}
+	if err := stmt.engine.checkConn(); err != nil {
+		return int64(0), err
+	}
+	if stmt.engine.IsDryRun() {
+		return int64(0), stmt.engine.logDryRun(stmt.ToSQL(bean))
+	}
+	if bean == nil {
+		// no bean, DELETE FROM ... WHERE ...
+		query, args, err := stmt.ToSQL(nil)
+		if err != nil {
+			return int64(0), err
+		}
+		sess := stmt.newSession()
+		r, err := sess.Exec(append([]interface{}{query}, args...)...)
+		return stmt.affected("delete", r, err)
+	}
 	sess := stmt.execStmt.createExecSession()
-	return sess.Delete(bean)
+	ac, err := sess.Delete(bean)
+	return ac, stmt.wrote(stmt.wrapError("delete", err))
+}
+
+type InsertResult struct {
+	RowsAffected  int64
+	FirstInsertId int64 // auto-increment id of the first inserted row, 0 if any bean of a slice has a preset id
+	LastInsertId  int64 // auto-increment id of the last inserted row, 0 if the ids of a slice may be not consecutive
+}
+
+// the auto-increment ids are filled back into the beans.
+// a slice of beans is inserted with one statement. Its ids are only filled, and LastInsertId is only set, if they are
+// known to be consecutive: no bean has a preset id and @@innodb_autoinc_lock_mode is 0 or 1. With the lock mode 2,
+// the default of MySQL 8, concurrent inserts may interleave the ids, so they must be read back by the caller.
+func (stmt *insertStmt) ExecWithResult(bean interface{}) (*InsertResult, error) {
+	res, err := stmt.execWithResult(bean)
+	if res.RowsAffected > 0 {
+		stmt.wrote(nil)
+	}
+	return res, err
+}
+
+func (stmt *insertStmt) execWithResult(bean interface{}) (*InsertResult, error) {
+	res := &InsertResult{}
+	if err := stmt.engine.checkConn(); err != nil {
+		return res, err
+	}
+	if stmt.engine.IsDryRun() {
+		return res, stmt.engine.logDryRun(stmt.ToSQL(bean))
+	}
+	beans := toBeans(bean)
+	if len(beans) == 0 {
+		return res, nil
+	}
+	aiCol := stmt.engine.autoIncrColumn(beans[0])
+	if !isSlice(bean) {
+		// only one bean, the id is filled by xorm
+		sess := stmt.newSession()
+		ac, err := sess.Insert(bean)
+		if err != nil {
+			return res, stmt.wrapError("insert", err)
+		}
+		res.RowsAffected = ac
+		if aiCol != nil {
+			if fv, err := aiCol.ValueOf(bean); err == nil {
+				res.FirstInsertId = toInt64(*fv)
+				res.LastInsertId = res.FirstInsertId
+			}
+		}
+		return res, nil
+	}
+
+	if aiCol == nil {
+		sess := stmt.newSession()
+		ac, err := sess.Insert(bean)
+		res.RowsAffected = ac
+		return res, stmt.wrapError("insert", err)
+	}
+
+	presetId := false
+	for _, b := range beans {
+		if fv, err := aiCol.ValueOf(b); err == nil && !fv.IsZero() {
+			presetId = true
+			break
+		}
+	}
+
+	// LAST_INSERT_ID() must be queried with the connection of INSERT
+	sess := stmt.session
+	if sess == nil {
+		sess = stmt.engine.NewSession()
+		defer sess.Close()
+		if stmt.ctx != nil {
+			sess = sess.Context(stmt.ctx)
+		}
+		if err := sess.Begin(); err != nil {
+			return res, stmt.wrapError("insert", err)
+		}
+	}
+	ac, err := sess.Table(stmt.table).Insert(bean)
+	if err != nil {
+		return res, stmt.wrapError("insert", err)
+	}
+	rows, err := sess.QuerySliceString("SELECT LAST_INSERT_ID(), @@auto_increment_increment, @@innodb_autoinc_lock_mode")
+	if err != nil {
+		return res, stmt.wrapError("insert", err)
+	}
+	if stmt.session == nil {
+		if err = sess.Commit(); err != nil {
+			return res, stmt.wrapError("insert", err)
+		}
+	}
+	res.RowsAffected = ac
+	if presetId || len(rows) == 0 || len(rows[0]) < 3 {
+		// LAST_INSERT_ID() is not the id of the first bean
+		return res, nil
+	}
+	firstId, _ := strconv.ParseInt(rows[0][0], 10, 64)
+	res.FirstInsertId = firstId
+	if lockMode := rows[0][2]; lockMode != "0" && lockMode != "1" {
+		// the ids may be not consecutive
+		return res, nil
+	}
+	step, _ := strconv.ParseInt(rows[0][1], 10, 64)
+	if step <= 0 {
+		step = 1
+	}
+	res.LastInsertId = firstId + step*int64(len(beans)-1)
+	for i, b := range beans {
+		if fv, err := aiCol.ValueOf(b); err == nil && fv.CanSet() {
+			setInt64(*fv, firstId + step*int64(i))
+		}
+	}
+	return res, nil
 }
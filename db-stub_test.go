@@ -0,0 +1,214 @@
+package dbx
+
+import (
+	"database/sql/driver"
+	"database/sql"
+	"xorm.io/core"
+	"sync/atomic"
+	"testing"
+	"strings"
+	"context"
+	"sync"
+	"io"
+	"fmt"
+)
+
+// a database/sql driver for tests, the statements are answered by the handler of the stub db
+const stubDriverName = "dbx-stub"
+
+type stubResult struct {
+	cols []string
+	rows [][]driver.Value
+	rowsErr error // returned by Next() instead of io.EOF after the rows
+	lastInsertId int64
+	affected int64
+	err error
+}
+
+type stubHandler func(query string, args []driver.Value) stubResult
+
+type stubDB struct {
+	handler stubHandler
+	mu sync.Mutex
+	stmts []string // the statements run, with BEGIN/COMMIT/ROLLBACK which are passed to the handler too
+	openRows int32 // the rows not closed
+}
+
+var (
+	stubDBs sync.Map
+	stubSeq int64
+)
+
+func init() {
+	sql.Register(stubDriverName, stubDriver{})
+	core.RegisterDriver(stubDriverName, stubDriver{})
+}
+
+// a db answered by handler, a nil handler answers every statement with an empty result
+func newStubDB(t *testing.T, handler stubHandler, options ...DBOption) (*DBI, *stubDB) {
+	dsn, stub := newStubDSN(t, handler)
+	db, err := CreateDriverDBInstance(stubDriverName, dsn, options...)
+	if err != nil {
+		t.Fatalf("failed to create stub db: %v", err)
+	}
+	db.SetLogLevel(core.LOG_OFF)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db, stub
+}
+
+// the DSN of a stub db, which can be given to Replicas()
+func newStubDSN(t *testing.T, handler stubHandler) (string, *stubDB) {
+	if handler == nil {
+		handler = func(string, []driver.Value) stubResult { return stubResult{} }
+	}
+	stub := &stubDB{handler: handler}
+	dsn := fmt.Sprintf("stub-%d", atomic.AddInt64(&stubSeq, 1))
+	stubDBs.Store(dsn, stub)
+	t.Cleanup(func() {
+		stubDBs.Delete(dsn)
+	})
+	return dsn, stub
+}
+
+func (s *stubDB) run(query string, args []driver.Value) stubResult {
+	s.mu.Lock()
+	s.stmts = append(s.stmts, query)
+	s.mu.Unlock()
+	return s.handler(query, args)
+}
+
+func (s *stubDB) OpenRows() int {
+	return int(atomic.LoadInt32(&s.openRows))
+}
+
+func (s *stubDB) Stmts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.stmts...)
+}
+
+type stubDriver struct{}
+
+func (stubDriver) Parse(driverName, dsn string) (*core.Uri, error) {
+	return &core.Uri{DbType: core.MYSQL, DbName: "test"}, nil
+}
+
+func (stubDriver) Open(dsn string) (driver.Conn, error) {
+	stub, ok := stubDBs.Load(dsn)
+	if !ok {
+		return nil, fmt.Errorf("no stub db %s", dsn)
+	}
+	return &stubConn{db: stub.(*stubDB)}, nil
+}
+
+type stubConn struct {
+	db *stubDB
+}
+
+func (c *stubConn) Prepare(query string) (driver.Stmt, error) {
+	return &stubStmt{conn: c, query: query}, nil
+}
+func (c *stubConn) Close() error { return nil }
+func (c *stubConn) Begin() (driver.Tx, error) {
+	if r := c.db.run("BEGIN", nil); r.err != nil {
+		return nil, r.err
+	}
+	return &stubTx{db: c.db}, nil
+}
+
+func (c *stubConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r := c.db.run(query, namedValues(args))
+	if r.err != nil {
+		return nil, r.err
+	}
+	return stubExecResult(r), nil
+}
+
+func (c *stubConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r := c.db.run(query, namedValues(args))
+	if r.err != nil {
+		return nil, r.err
+	}
+	return newStubRows(c.db, r), nil
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		vals[i] = arg.Value
+	}
+	return vals
+}
+
+type stubTx struct {
+	db *stubDB
+}
+// the handler is called with "COMMIT" or "ROLLBACK", and its err is returned
+func (tx *stubTx) Commit() error {
+	return tx.db.run("COMMIT", nil).err
+}
+func (tx *stubTx) Rollback() error {
+	return tx.db.run("ROLLBACK", nil).err
+}
+
+type stubStmt struct {
+	conn *stubConn
+	query string
+}
+func (s *stubStmt) Close() error { return nil }
+func (s *stubStmt) NumInput() int { return -1 }
+func (s *stubStmt) Exec(args []driver.Value) (driver.Result, error) {
+	r := s.conn.db.run(s.query, args)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return stubExecResult(r), nil
+}
+func (s *stubStmt) Query(args []driver.Value) (driver.Rows, error) {
+	r := s.conn.db.run(s.query, args)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return newStubRows(s.conn.db, r), nil
+}
+
+type stubExecResult stubResult
+func (r stubExecResult) LastInsertId() (int64, error) { return r.lastInsertId, nil }
+func (r stubExecResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type stubRows struct {
+	db *stubDB
+	res stubResult
+	i int
+	closed bool
+}
+func newStubRows(db *stubDB, res stubResult) *stubRows {
+	atomic.AddInt32(&db.openRows, 1)
+	return &stubRows{db: db, res: res}
+}
+func (r *stubRows) Columns() []string { return r.res.cols }
+func (r *stubRows) Close() error {
+	if !r.closed {
+		r.closed = true
+		atomic.AddInt32(&r.db.openRows, -1)
+	}
+	return nil
+}
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.res.rows) {
+		if r.res.rowsErr != nil {
+			return r.res.rowsErr
+		}
+		return io.EOF
+	}
+	copy(dest, r.res.rows[r.i])
+	r.i += 1
+	return nil
+}
+
+// rows of a stubResult
+func stubRowsOf(cols string, rows ...[]driver.Value) stubResult {
+	return stubResult{cols: strings.Split(cols, ","), rows: rows}
+}
@@ -6,6 +6,9 @@ func SyncTable(pTblStruct interface{}, tblName ...string) error {
 }
 
 func (db *DBI) SyncTable(pTblStruct interface{}, tblName ...string) error {
+	if err := db.checkConn(); err != nil {
+		return err
+	}
 	if len(tblName) > 0 && len(tblName[0]) > 0 {
 		return db.Engine.Table(tblName[0]).Sync2(pTblStruct)
 	}
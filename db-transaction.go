@@ -1,29 +1,32 @@
 package dbx
 
 import (
-	"fmt"
+	"database/sql"
+	"runtime/debug"
+	"context"
+	"errors"
 )
 
 type TxStmt struct {
 	*dbxStmt
 	args map[ArgKey]interface{}
 	session *Session
+	ctx context.Context
+	attempt int
+	savepoints int // the number of savepoints created by Nested()
 }
 
 func TxStmts(stmts ...FnTxStmt) []FnTxStmt {
 	return stmts
 }
 
-func (db *DBI) newTxStmt(session *Session, table string, txArgs ...TxA) *TxStmt {
-	args := make(map[ArgKey]interface{})
-	for _, txArg := range txArgs {
-		txArg(&args)
-	}
-
+func (db *DBI) newTxStmt(ctx context.Context, session *Session, table string, args map[ArgKey]interface{}, attempt int) *TxStmt {
 	return &TxStmt{
 		dbxStmt: db.XStmt(table).XSession(session),
 		args: args,
 		session: session,
+		ctx: ctx,
+		attempt: attempt,
 	}
 }
 
@@ -41,11 +44,7 @@ func TxArgs(args map[ArgKey]interface{}) TxA {
 			return
 		}
 
-		if len(*oldArgs) == 0 {
-			*oldArgs = args
-			return
-		}
-
+		// copied, the args are fresh when the transaction is retried
 		for k, v := range args {
 			(*oldArgs)[k] = v
 		}
@@ -71,43 +70,126 @@ func (ts *TxStmt) SetArg(name ArgKey, val interface{}) {
 	ts.args[name] = val
 }
 
+// the context of the transaction
+func (ts *TxStmt) Context() context.Context {
+	return ts.ctx
+}
+
+// the attempt number of the transaction, starting from 1, see TxRetry()
+func (ts *TxStmt) Attempt() int {
+	return ts.attempt
+}
+
 func Tx(stmts []FnTxStmt, txArgs ...TxA) error {
 	db := getDefaultConnection()
 	return db.Tx(stmts, txArgs...)
 }
 
-func (db *DBI) Tx(stmts []FnTxStmt, txArgs ...TxA) (err error) {
+func TxContext(ctx context.Context, stmts []FnTxStmt, txArgs ...TxA) error {
+	db := getDefaultConnection()
+	return db.TxContext(ctx, stmts, txArgs...)
+}
+
+func (db *DBI) Tx(stmts []FnTxStmt, txArgs ...TxA) error {
+	return db.TxContext(context.Background(), stmts, txArgs...)
+}
+
+// the transaction will be rolled back if ctx is done before committing.
+// TxIsolation(), TxReadOnly(), TxTimeout() and TxRetry() can be given in txArgs.
+// a panic in FnTxStmt is returned as *TxPanicError after rolling back.
+// in dry-run mode, the statements of the transaction are logged and nothing is sent to the db.
+func (db *DBI) TxContext(ctx context.Context, stmts []FnTxStmt, txArgs ...TxA) error {
 	if len(stmts) == 0 {
 		return nil
 	}
+	if err := db.checkConn(); err != nil {
+		return err
+	}
+
+	_, txOpts := makeTxArgs(txArgs...)
+	for attempt := 1; ; attempt++ {
+		committing, err := db.runTx(ctx, stmts, attempt, txArgs...)
+		if err == nil || committing || attempt >= txOpts.maxAttempts || !isRetryable(err) {
+			return err
+		}
+		db.Logger().Warnf("transaction attempt #%d failed: %v, retrying", attempt, err)
+		if err = sleepContext(ctx, txOpts.backoffDelay(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+// committing is true if the commit has been sent
+func (db *DBI) runTx(ctx context.Context, stmts []FnTxStmt, attempt int, txArgs ...TxA) (committing bool, err error) {
+	args, txOpts := makeTxArgs(txArgs...)
+	ctx, cancel := txOpts.context(ctx)
+	defer cancel()
+
+	session := db.NewSession().Context(ctx)
+	defer session.Close()
+	dryRun := db.IsDryRun()
+	if dryRun {
+		db.logDryRun("BEGIN", nil, nil)
+	} else if err = session.Begin(); err != nil {
+		return false, wrapError("begin", "", err)
+	}
 
 	defer func() {
 		if r := recover(); r != nil {
-			var ok bool
-			if err, ok = r.(error); ok {
-				return // err to call FnTxStmt()
-			}
-			fmt.Printf("panic in FnTxStmt: %v\n", r)
+			err = &TxPanicError{Value: r, Stack: debug.Stack()}
+			db.Logger().Errorf("panic in FnTxStmt: %v\n%s", r, err.(*TxPanicError).Stack)
+		}
+		if err == nil || committing {
+			// a failed commit can't be rolled back
+			return
+		}
+		if dryRun {
+			db.logDryRun("ROLLBACK", nil, nil)
+			return
+		}
+		if rbErr := session.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			db.Logger().Errorf("failed to rollback: %v, the cause: %v", rbErr, err)
+			err = &RollbackError{Err: err, RollbackErr: rbErr}
 		}
 	}()
 
-	session := db.NewSession()
-	defer session.Close()
-	if err = session.Begin(); err != nil {
-		return err
+	if err = txOpts.apply(db, session); err != nil {
+		return false, wrapError("begin", "", err)
 	}
 
-	txStmt := db.newTxStmt(session, "", txArgs...)
+	txStmt := db.newTxStmt(ctx, session, "", args, attempt)
 	for i, _ := range stmts {
 		fnTx := stmts[i]
 		if fnTx == nil {
 			continue
 		}
+		if err = ctx.Err(); err != nil {
+			return false, err
+		}
 		if err = fnTx(txStmt); err != nil {
-			return err
+			return false, err
 		}
 	}
 
-	session.Commit()
-	return nil
+	if err = ctx.Err(); err != nil {
+		return false, err
+	}
+	committing = true
+	if dryRun {
+		return true, db.logDryRun("COMMIT", nil, nil)
+	}
+	if err = session.Commit(); err != nil {
+		return true, wrapError("commit", "", err)
+	}
+	db.markWrite(ctx)
+	return true, nil
+}
+
+// statements of the transaction itself, logged instead of being executed in dry-run mode
+func (db *DBI) execTx(session *Session, query string) error {
+	if db.IsDryRun() {
+		return db.logDryRun(query, nil, nil)
+	}
+	_, err := session.Exec(query)
+	return err
 }
@@ -0,0 +1,161 @@
+package dbx
+
+import (
+	"github.com/go-sql-driver/mysql"
+	"database/sql/driver"
+	"testing"
+	"context"
+	"strings"
+	"errors"
+	"time"
+	"fmt"
+)
+
+func TestTxLifecycle(t *testing.T) {
+	var commitErr, rollbackErr error
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		switch query {
+		case "COMMIT":
+			return stubResult{err: commitErr}
+		case "ROLLBACK":
+			return stubResult{err: rollbackErr}
+		}
+		return stubResult{affected: 1}
+	})
+
+	update := func(stmt *TxStmt) error {
+		_, err := stmt.Table("user").Set(SetExpr("age", "age+1")).Where(Eq("id", 1)).Update(nil)
+		return err
+	}
+	cause := errors.New("insufficient balance")
+	cases := []struct{
+		name string
+		step FnTxStmt
+		commitErr, rollbackErr error
+		check func(err error) bool
+		expected []string
+	}{
+		{"commit", update, nil, nil,
+			func(err error) bool { return err == nil },
+			[]string{"BEGIN", "UPDATE user SET `age`=age+1 WHERE (`id`=?)", "UPDATE user SET `age`=age+1 WHERE (`id`=?)", "COMMIT"}},
+		{"failed", func(stmt *TxStmt) error { return cause }, nil, nil,
+			func(err error) bool { return err == cause },
+			[]string{"BEGIN", "UPDATE user SET `age`=age+1 WHERE (`id`=?)", "ROLLBACK"}},
+		{"panic", func(stmt *TxStmt) error { panic(cause) }, nil, nil,
+			func(err error) bool {
+				var pe *TxPanicError
+				return errors.As(err, &pe) && pe.Value == cause && len(pe.Stack) > 0 && errors.Is(err, cause)
+			},
+			[]string{"BEGIN", "UPDATE user SET `age`=age+1 WHERE (`id`=?)", "ROLLBACK"}},
+		{"commit-failed", update, driver.ErrBadConn, nil,
+			// the failed commit is not rolled back
+			func(err error) bool { return errors.Is(err, driver.ErrBadConn) },
+			[]string{"BEGIN", "UPDATE user SET `age`=age+1 WHERE (`id`=?)", "UPDATE user SET `age`=age+1 WHERE (`id`=?)", "COMMIT"}},
+		{"rollback-failed", func(stmt *TxStmt) error { return cause }, nil, errors.New("rollback failed"),
+			func(err error) bool {
+				var re *RollbackError
+				return errors.As(err, &re) && re.Err == cause && re.RollbackErr.Error() == "rollback failed"
+			},
+			[]string{"BEGIN", "UPDATE user SET `age`=age+1 WHERE (`id`=?)", "ROLLBACK"}},
+	}
+	for _, c := range cases {
+		commitErr, rollbackErr = c.commitErr, c.rollbackErr
+		n := len(stub.Stmts())
+		err := db.Tx(TxStmts(update, c.step))
+		if !c.check(err) {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+		if stmts := stub.Stmts()[n:]; fmt.Sprint(stmts) != fmt.Sprint(c.expected) {
+			t.Fatalf("%s: expected %q, got %q", c.name, c.expected, stmts)
+		}
+	}
+}
+
+func TestTxRetryStub(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number:1213}
+	var updates int
+	var failUpdates int // the number of UPDATE failing with a deadlock
+	var commitErr error
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		switch {
+		case query == "COMMIT":
+			return stubResult{err: commitErr}
+		case strings.HasPrefix(query, "UPDATE"):
+			if updates += 1; updates <= failUpdates {
+				return stubResult{err: deadlock}
+			}
+		}
+		return stubResult{affected: 1}
+	})
+
+	var attempts, seen []interface{}
+	steps := TxStmts(
+		func(stmt *TxStmt) error {
+			attempts = append(attempts, stmt.Attempt())
+			seen = append(seen, stmt.Arg("n"))
+			stmt.SetArg("n", 100)
+			return nil
+		},
+		func(stmt *TxStmt) error {
+			_, err := stmt.Table("user").Set(SetValue("age", stmt.Arg("n"))).Where(Eq("id", 1)).Update(nil)
+			return err
+		},
+	)
+
+	failUpdates = 1
+	if err := db.Tx(steps, TxArg("n", 1), TxRetry(3, time.Millisecond)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	// the whole chain is run again with the fresh args
+	if fmt.Sprint(attempts) != "[1 2]" || fmt.Sprint(seen) != "[1 1]" {
+		t.Fatalf("unexpected attempts %v with args %v", attempts, seen)
+	}
+	expected := []string{"BEGIN", "UPDATE user SET `age`=? WHERE (`id`=?)", "ROLLBACK", "BEGIN", "UPDATE user SET `age`=? WHERE (`id`=?)", "COMMIT"}
+	if stmts := stub.Stmts(); fmt.Sprint(stmts) != fmt.Sprint(expected) {
+		t.Fatalf("expected %q, got %q", expected, stmts)
+	}
+
+	// gives up after the max attempts
+	attempts, updates, failUpdates = nil, 0, 10
+	if err := db.Tx(steps, TxArg("n", 1), TxRetry(3, time.Millisecond)); !IsDeadlock(err) || len(attempts) != 3 {
+		t.Fatalf("the deadlock expected after 3 attempts, got %v after %d", err, len(attempts))
+	}
+
+	// nothing is retried after COMMIT is sent
+	attempts, updates, failUpdates, commitErr = nil, 0, 0, deadlock
+	n := len(stub.Stmts())
+	if err := db.Tx(steps, TxArg("n", 1), TxRetry(3, time.Millisecond)); !IsDeadlock(err) || len(attempts) != 1 {
+		t.Fatalf("the deadlock of COMMIT expected without retrying, got %v after %d attempts", err, len(attempts))
+	}
+	expected = []string{"BEGIN", "UPDATE user SET `age`=? WHERE (`id`=?)", "COMMIT"}
+	if stmts := stub.Stmts()[n:]; fmt.Sprint(stmts) != fmt.Sprint(expected) {
+		t.Fatalf("expected %q, got %q", expected, stmts)
+	}
+}
+
+func TestTxContextCancel(t *testing.T) {
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		return stubResult{affected: 1}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := false
+	err := db.TxContext(ctx, TxStmts(
+		func(stmt *TxStmt) error {
+			_, err := stmt.Table("user").Set(SetExpr("age", "age+1")).Where(Eq("id", 1)).Update(nil)
+			cancel()
+			return err
+		},
+		func(stmt *TxStmt) error {
+			done = true
+			return nil
+		},
+	))
+	if !errors.Is(err, context.Canceled) || done {
+		t.Fatalf("context.Canceled expected before the next step, got %v", err)
+	}
+	expected := []string{"BEGIN", "UPDATE user SET `age`=age+1 WHERE (`id`=?)", "ROLLBACK"}
+	if stmts := stub.Stmts(); fmt.Sprint(stmts) != fmt.Sprint(expected) {
+		t.Fatalf("expected %q, got %q", expected, stmts)
+	}
+}
@@ -0,0 +1,174 @@
+// options of transactions
+package dbx
+
+import (
+	"database/sql"
+	"math/rand"
+	"context"
+	"errors"
+	"time"
+	"fmt"
+)
+
+// the options are kept in the tx args with this key, and removed before running the FnTxStmts
+const txOptionsKey ArgKey = "__dbx_tx_options__"
+
+type txOptions struct {
+	isolation sql.IsolationLevel
+	readOnly bool
+	timeout time.Duration
+	maxAttempts int
+	backoff time.Duration
+}
+
+func withTxOptions(o func(*txOptions)) TxA {
+	return func(args *map[ArgKey]interface{}) {
+		if *args == nil {
+			*args = make(map[ArgKey]interface{})
+		}
+		opts, ok := (*args)[txOptionsKey].(*txOptions)
+		if !ok {
+			opts = &txOptions{}
+			(*args)[txOptionsKey] = opts
+		}
+		o(opts)
+	}
+}
+
+// one of sql.LevelReadUncommitted, sql.LevelReadCommitted, sql.LevelRepeatableRead and sql.LevelSerializable
+//  eg. db.Tx(stmts, dbx.TxIsolation(sql.LevelSerializable))
+func TxIsolation(level sql.IsolationLevel) TxA {
+	return withTxOptions(func(opts *txOptions) {
+		opts.isolation = level
+	})
+}
+
+func TxReadOnly() TxA {
+	return withTxOptions(func(opts *txOptions) {
+		opts.readOnly = true
+	})
+}
+
+// the transaction is rolled back if it is not committed in d
+func TxTimeout(d time.Duration) TxA {
+	return withTxOptions(func(opts *txOptions) {
+		opts.timeout = d
+	})
+}
+
+// the transaction is run at most maxAttempts times if it fails with a deadlock or a lock wait timeout,
+// with fresh args. The delay before the n-th retry is a random duration in [backoff*2^(n-1)/2, backoff*2^(n-1)).
+// It is never retried after the commit has been sent.
+func TxRetry(maxAttempts int, backoff time.Duration) TxA {
+	return withTxOptions(func(opts *txOptions) {
+		opts.maxAttempts = maxAttempts
+		opts.backoff = backoff
+	})
+}
+
+// the args for FnTxStmt, and the options of the transaction
+func makeTxArgs(txArgs ...TxA) (map[ArgKey]interface{}, *txOptions) {
+	args := make(map[ArgKey]interface{})
+	for _, txArg := range txArgs {
+		txArg(&args)
+	}
+	opts, ok := args[txOptionsKey].(*txOptions)
+	if !ok {
+		opts = &txOptions{}
+	}
+	delete(args, txOptionsKey)
+	return args, opts
+}
+
+const maxBackoff = 10*time.Second
+
+func (opts *txOptions) backoffDelay(attempt int) time.Duration {
+	if opts.backoff <= 0 {
+		return 0
+	}
+	d := opts.backoff
+	for i:=1; i<attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// panics are never retried
+func isRetryable(err error) bool {
+	var pe *TxPanicError
+	if errors.As(err, &pe) {
+		return false
+	}
+	if IsDeadlock(err) || IsLockWaitTimeout(err) {
+		return true
+	}
+	kind := classifyError(err)
+	return kind == ErrDeadlock || kind == ErrLockWaitTimeout
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (opts *txOptions) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if opts.timeout > 0 {
+		return context.WithTimeout(ctx, opts.timeout)
+	}
+	return ctx, func(){}
+}
+
+func (opts *txOptions) characteristics() (string, error) {
+	switch opts.isolation {
+	case sql.LevelDefault:
+		return "", nil
+	case sql.LevelReadUncommitted:
+		return "READ UNCOMMITTED", nil
+	case sql.LevelReadCommitted:
+		return "READ COMMITTED", nil
+	case sql.LevelRepeatableRead:
+		return "REPEATABLE READ", nil
+	case sql.LevelSerializable:
+		return "SERIALIZABLE", nil
+	default:
+		return "", fmt.Errorf("isolation level %v is not supported", opts.isolation)
+	}
+}
+
+// xorm begins transactions without options, so the empty transaction is restarted
+// on the same connection with the isolation level and the access mode.
+func (opts *txOptions) apply(db *DBI, session *Session) error {
+	isolation, err := opts.characteristics()
+	if err != nil {
+		return err
+	}
+	if len(isolation) == 0 && !opts.readOnly {
+		return nil
+	}
+	if len(isolation) > 0 {
+		// SET TRANSACTION is not permitted in a transaction
+		if err = db.execTx(session, "COMMIT"); err != nil {
+			return err
+		}
+		if err = db.execTx(session, "SET TRANSACTION ISOLATION LEVEL " + isolation); err != nil {
+			return err
+		}
+	}
+	start := "START TRANSACTION"
+	if opts.readOnly {
+		start = "START TRANSACTION READ ONLY"
+	}
+	return db.execTx(session, start)
+}
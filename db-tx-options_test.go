@@ -0,0 +1,202 @@
+package dbx
+
+import (
+	"github.com/go-sql-driver/mysql"
+	"database/sql/driver"
+	"database/sql"
+	"testing"
+	"context"
+	"strings"
+	"errors"
+	"time"
+)
+
+func TestTxOptions(t *testing.T) {
+	args, opts := makeTxArgs(TxArg("a", 1), TxIsolation(sql.LevelSerializable), TxReadOnly(), TxTimeout(time.Second))
+	if len(args) != 1 || args["a"] != 1 {
+		t.Fatalf("the options should be removed from args, got %v", args)
+	}
+	if !opts.readOnly || opts.timeout != time.Second {
+		t.Fatalf("bad options %+v", opts)
+	}
+	if c, err := opts.characteristics(); err != nil || c != "SERIALIZABLE" {
+		t.Fatalf("SERIALIZABLE expected, got %q, %v", c, err)
+	}
+
+	_, opts = makeTxArgs(TxArgs(map[ArgKey]interface{}{"b": 2}), TxIsolation(sql.LevelRepeatableRead))
+	if c, _ := opts.characteristics(); c != "REPEATABLE READ" {
+		t.Fatalf("REPEATABLE READ expected, got %q", c)
+	}
+	_, opts = makeTxArgs()
+	if c, err := opts.characteristics(); err != nil || c != "" || opts.readOnly || opts.timeout != 0 {
+		t.Fatalf("no options expected, got %+v", opts)
+	}
+	_, opts = makeTxArgs(TxIsolation(sql.LevelLinearizable))
+	if _, err := opts.characteristics(); err == nil {
+		t.Fatalf("error expected for an unsupported isolation level")
+	}
+}
+
+func TestTxRetry(t *testing.T) {
+	userArgs := map[ArgKey]interface{}{"a": 1}
+	args, opts := makeTxArgs(TxArgs(userArgs), TxRetry(3, 10*time.Millisecond))
+	args["a"] = 2
+	if userArgs["a"] != 1 || len(userArgs) != 1 {
+		t.Fatalf("the args are expected to be fresh, got %v", userArgs)
+	}
+	if opts.maxAttempts != 3 {
+		t.Fatalf("3 attempts expected, got %d", opts.maxAttempts)
+	}
+	for attempt, max := 1, 10*time.Millisecond; attempt <= 3; attempt, max = attempt+1, max*2 {
+		if d := opts.backoffDelay(attempt); d < max/2 || d > max {
+			t.Fatalf("attempt #%d: delay %v is out of [%v, %v]", attempt, d, max/2, max)
+		}
+	}
+	if d := opts.backoffDelay(100); d > maxBackoff {
+		t.Fatalf("delay %v exceeds %v", d, maxBackoff)
+	}
+
+	deadlock := &mysql.MySQLError{Number:1213}
+	if !isRetryable(deadlock) || !isRetryable(wrapError("update", "user", deadlock)) ||
+		!isRetryable(wrapError("update", "user", &mysql.MySQLError{Number:1205})) {
+		t.Fatalf("deadlock and lock wait timeout are expected to be retryable")
+	}
+	if isRetryable(wrapError("insert", "user", &mysql.MySQLError{Number:1062})) || isRetryable(&TxPanicError{Value: deadlock}) {
+		t.Fatalf("only deadlock and lock wait timeout are expected to be retryable")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sleepContext(ctx, time.Second); err != context.Canceled {
+		t.Fatalf("context.Canceled expected, got %v", err)
+	}
+	if ts := newTestDB(t).newTxStmt(ctx, nil, "", nil, 2); ts.Attempt() != 2 {
+		t.Fatalf("attempt #2 expected, got %d", ts.Attempt())
+	}
+}
+
+func TestSavepointNames(t *testing.T) {
+	ts := newTestDB(t).newTxStmt(context.Background(), nil, "", nil, 1)
+	for _, name := range []string{"", "1sp", "sp`; DROP TABLE user", "a b"} {
+		if err := ts.Savepoint(name); err == nil {
+			t.Fatalf("error expected for savepoint name %q", name)
+		}
+	}
+	for _, name := range []string{"sp", "_sp1", "dbx_nested_1"} {
+		if !isIdentifier(name) {
+			t.Fatalf("%q is expected to be an identifier", name)
+		}
+	}
+}
+
+func TestNested(t *testing.T) {
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		return stubResult{affected: 1}
+	})
+
+	errSkipped := errors.New("skipped")
+	err := db.Tx(TxStmts(
+		func(ts *TxStmt) error {
+			_, err := ts.Table("user").Set(SetExpr("age", "age+1")).Where(Eq("id", 1)).Update(nil)
+			return err
+		},
+		func(ts *TxStmt) error {
+			// the failing step is undone, and the transaction goes on
+			err := ts.Nested(func(ts *TxStmt) error {
+				if _, err := ts.Table("log").Set(SetValue("n", 1)).Where(Eq("id", 1)).Update(nil); err != nil {
+					return err
+				}
+				return errSkipped
+			})
+			if !errors.Is(err, errSkipped) {
+				t.Fatalf("errSkipped expected, got %v", err)
+			}
+			err = ts.Nested(func(ts *TxStmt) error {
+				panic("oops")
+			})
+			var pe *TxPanicError
+			if !errors.As(err, &pe) {
+				t.Fatalf("TxPanicError expected, got %v", err)
+			}
+			return ts.Nested(func(ts *TxStmt) error {
+				_, err := ts.Table("log").Set(SetValue("n", 2)).Where(Eq("id", 2)).Update(nil)
+				return err
+			})
+		},
+		func(ts *TxStmt) error {
+			_, err := ts.Table("user").Set(SetExpr("age", "age-1")).Where(Eq("id", 2)).Update(nil)
+			return err
+		},
+	))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := []string{
+		"BEGIN",
+		"UPDATE user SET `age`=age+1 WHERE (`id`=?)",
+		"SAVEPOINT `dbx_nested_1`",
+		"UPDATE log SET `n`=? WHERE (`id`=?)",
+		"ROLLBACK TO SAVEPOINT `dbx_nested_1`",
+		"RELEASE SAVEPOINT `dbx_nested_1`",
+		"SAVEPOINT `dbx_nested_2`",
+		"ROLLBACK TO SAVEPOINT `dbx_nested_2`",
+		"RELEASE SAVEPOINT `dbx_nested_2`",
+		"SAVEPOINT `dbx_nested_3`",
+		"UPDATE log SET `n`=? WHERE (`id`=?)",
+		"RELEASE SAVEPOINT `dbx_nested_3`",
+		"UPDATE user SET `age`=age-1 WHERE (`id`=?)",
+		"COMMIT",
+	}
+	if stmts := stub.Stmts(); strings.Join(stmts, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected statements:\n%s", strings.Join(stmts, "\n"))
+	}
+}
+
+// xorm begins without options, so the transaction is restarted with them on the same connection
+func TestTxOptionsStatements(t *testing.T) {
+	db, stub := newStubDB(t, func(query string, args []driver.Value) stubResult {
+		return stubResult{affected: 1}
+	})
+	update := func(stmt *TxStmt) error {
+		_, err := stmt.Table("user").Set(SetExpr("age", "age+1")).Where(Eq("id", 1)).Update(nil)
+		return err
+	}
+	const updateSQL = "UPDATE user SET `age`=age+1 WHERE (`id`=?)"
+
+	cases := []struct{
+		name string
+		txArgs []TxA
+		expected []string
+	}{
+		{"default", nil, []string{"BEGIN", updateSQL, "COMMIT"}},
+		{"isolation", []TxA{TxIsolation(sql.LevelSerializable), TxReadOnly()},
+			[]string{"BEGIN", "COMMIT", "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE", "START TRANSACTION READ ONLY", updateSQL, "COMMIT"}},
+		{"read-only", []TxA{TxReadOnly()}, []string{"BEGIN", "START TRANSACTION READ ONLY", updateSQL, "COMMIT"}},
+		{"read-committed", []TxA{TxIsolation(sql.LevelReadCommitted)},
+			[]string{"BEGIN", "COMMIT", "SET TRANSACTION ISOLATION LEVEL READ COMMITTED", "START TRANSACTION", updateSQL, "COMMIT"}},
+	}
+	for _, c := range cases {
+		n := len(stub.Stmts())
+		if err := db.Tx(TxStmts(update), c.txArgs...); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if stmts := stub.Stmts()[n:]; strings.Join(stmts, ";") != strings.Join(c.expected, ";") {
+			t.Fatalf("%s: expected %q, got %q", c.name, c.expected, stmts)
+		}
+	}
+
+	// rolled back without committing when the timeout expires
+	n := len(stub.Stmts())
+	err := db.Tx(TxStmts(update, func(stmt *TxStmt) error {
+		<-stmt.Context().Done()
+		return nil
+	}), TxTimeout(10*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("context.DeadlineExceeded expected, got %v", err)
+	}
+	expected := []string{"BEGIN", updateSQL, "ROLLBACK"}
+	if stmts := stub.Stmts()[n:]; strings.Join(stmts, ";") != strings.Join(expected, ";") {
+		t.Fatalf("expected %q, got %q", expected, stmts)
+	}
+}
@@ -1,7 +1,9 @@
 package dbx
 
 import (
+	"database/sql/driver"
 	"reflect"
+	"fmt"
 )
 
 func isSlicePtr(res interface{}) (ok bool) {
@@ -14,6 +16,10 @@ func isSlicePtr(res interface{}) (ok bool) {
 	return
 }
 
+func isSlice(res interface{}) bool {
+	return reflect.Indirect(reflect.ValueOf(res)).Kind() == reflect.Slice
+}
+
 func mk1ElemSlicePtr(res interface{}) interface{} {
 	ev := reflect.ValueOf(res).Elem()
 	et := ev.Type()
@@ -32,3 +38,59 @@ func sliceLen(ptrSl interface{}) int {
 	sv := reflect.ValueOf(ptrSl).Elem()
 	return sv.Len()
 }
+
+// nil, nil pointer or a driver.Valuer with NULL value, such as invalid sql.NullXxx
+func isNullValue(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return true
+		}
+	}
+	if valuer, ok := val.(driver.Valuer); ok {
+		if dv, err := valuer.Value(); err == nil && dv == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func toInt64(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	default:
+		return 0
+	}
+}
+
+func setInt64(v reflect.Value, i int64) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(i))
+	}
+}
+
+// a new bean of the struct type of the slice elements
+func sliceElem(slicePtr interface{}) (interface{}, error) {
+	t := reflect.TypeOf(slicePtr)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("a pointer to slice expected, but %T given", slicePtr)
+	}
+	t = t.Elem().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("the elements of %T must be structs", slicePtr)
+	}
+	return reflect.New(t).Interface(), nil
+}
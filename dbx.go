@@ -1,5 +1,11 @@
 package dbx
 
+import (
+	"context"
+	"strings"
+	"fmt"
+)
+
 type DBXStmt = dbxStmt
 
 type dbxStmt struct {
@@ -11,6 +17,10 @@ type dbxStmt struct {
 	joinedElems []joinedElem
 	opts []O
 	selection string
+	session *Session
+	ctx context.Context
+	primary bool
+	after string // cursor of keyset pagination
 }
 
 func XStmt(tbl ...string) *dbxStmt {
@@ -39,6 +49,7 @@ func (s *dbxStmt) Table(tbl string, dontReset ...bool) *dbxStmt {
 		s.joinedElems = nil
 		s.opts = nil
 		s.selection = ""
+		s.after = ""
 	}
 	return s
 }
@@ -91,6 +102,11 @@ func (s *dbxStmt) Where(cond ...Cond) *dbxStmt {
 	return s
 }
 
+func (s *dbxStmt) AllRows() *dbxStmt {
+	s.conds = append(s.conds, AllRows())
+	return s
+}
+
 func (s *dbxStmt) And(cond ...AndElem) *dbxStmt {
 	if len(cond) > 0 {
 		for _, c := range cond {
@@ -124,6 +140,46 @@ func (s *dbxStmt) NotIn(field string, val ...interface{}) *dbxStmt {
 	return s
 }
 
+func (s *dbxStmt) Exists(sub *dbxStmt) *dbxStmt {
+	s.conds = append(s.conds, Exists(sub))
+	return s
+}
+
+func (s *dbxStmt) NotExists(sub *dbxStmt) *dbxStmt {
+	s.conds = append(s.conds, NotExists(sub))
+	return s
+}
+
+func (s *dbxStmt) IsNull(field string) *dbxStmt {
+	s.conds = append(s.conds, IsNull(field))
+	return s
+}
+
+func (s *dbxStmt) IsNotNull(field string) *dbxStmt {
+	s.conds = append(s.conds, IsNotNull(field))
+	return s
+}
+
+func (s *dbxStmt) Between(field string, lo, hi interface{}) *dbxStmt {
+	s.conds = append(s.conds, Between(field, lo, hi))
+	return s
+}
+
+func (s *dbxStmt) NotBetween(field string, lo, hi interface{}) *dbxStmt {
+	s.conds = append(s.conds, NotBetween(field, lo, hi))
+	return s
+}
+
+func (s *dbxStmt) Like(field string, pattern string) *dbxStmt {
+	s.conds = append(s.conds, Like(field, pattern))
+	return s
+}
+
+func (s *dbxStmt) NotLike(field string, pattern string) *dbxStmt {
+	s.conds = append(s.conds, NotLike(field, pattern))
+	return s
+}
+
 func (s *dbxStmt) Set(set ...Set) *dbxStmt {
 	if len(set) > 0 {
 		s.sets = append(s.sets, set...)
@@ -173,11 +229,37 @@ func (s *dbxStmt) Limit(count int, offset ...int) *dbxStmt {
 	return s
 }
 
+// session and context are kept after calling Table()
 func (s *dbxStmt) XSession(session *Session) *dbxStmt {
-	s.opts = append(s.opts, WithSession(session))
+	s.session = session
+	return s
+}
+
+func (s *dbxStmt) WithContext(ctx context.Context) *dbxStmt {
+	s.ctx = ctx
+	return s
+}
+
+// reads are sent to the primary even if there're replicas, kept after calling Table()
+func (s *dbxStmt) Primary() *dbxStmt {
+	s.primary = true
 	return s
 }
 
+func (s *dbxStmt) options() []O {
+	opts := append([]O(nil), s.opts...)
+	if s.session != nil {
+		opts = append(opts, WithSession(s.session))
+	}
+	if s.ctx != nil {
+		opts = append(opts, WithContext(s.ctx))
+	}
+	if s.primary {
+		opts = append(opts, ReadPrimary())
+	}
+	return opts
+}
+
 func (s *dbxStmt) Get(res interface{}) (has bool, err error) {
 	if len(s.joinedElems) > 0 {
 		s.opts = append(s.opts, Limit(1))
@@ -185,10 +267,10 @@ func (s *dbxStmt) Get(res interface{}) (has bool, err error) {
 		return getOneFromList(stmt, res)
 	} else if len(s.selection) > 0 {
 		s.opts = append(s.opts, Limit(1))
-		stmt := s.engine.SelectStmt(s.table, []string{s.selection}, s.conds, s.opts...)
+		stmt := s.engine.SelectStmt(s.table, []string{s.selection}, s.conds, s.options()...)
 		return getOneFromList(stmt, res)
 	}
-	return s.engine.Get(s.table, s.conds, res, s.opts...)
+	return s.engine.Get(s.table, s.conds, res, s.options()...)
 }
 
 func (s *dbxStmt) List(res interface{}) error {
@@ -196,52 +278,109 @@ func (s *dbxStmt) List(res interface{}) error {
 		_, err := stmt.Exec(res)
 		return err
 	} else if len(s.selection) > 0 {
-		return s.engine.Select(s.table, []string{s.selection}, s.conds, res, s.opts...)
+		return s.engine.Select(s.table, []string{s.selection}, s.conds, res, s.options()...)
 	}
-	return s.engine.List(s.table, s.conds, res, s.opts...)
+	return s.engine.List(s.table, s.conds, res, s.options()...)
 }
 
 func (s *dbxStmt) Insert(vals interface{}) error {
-	return s.engine.Insert(s.table, vals, s.opts...)
+	return s.engine.Insert(s.table, vals, s.options()...)
+}
+
+func (s *dbxStmt) InsertWithResult(vals interface{}) (*InsertResult, error) {
+	return s.engine.InsertWithResult(s.table, vals, s.options()...)
 }
 
 func (s *dbxStmt) Update(vals interface{}) (int64, error) {
 	if len(s.sets) == 0 {
-		return s.engine.Update(s.table, s.conds, s.cols, vals, s.opts...)
+		return s.engine.Update(s.table, s.conds, s.cols, vals, s.options()...)
 	}
-	return s.engine.UpdateSet(s.table, s.sets, s.conds, s.opts...)
+	return s.engine.UpdateSet(s.table, s.sets, s.conds, s.options()...)
 }
 
-func (s *dbxStmt) Delete(vals interface{}) error {
-	return s.engine.Delete(s.table, s.conds, vals, s.opts...)
+// INSERT ... ON DUPLICATE KEY UPDATE, the update part is given by Set(), or updateCols
+func (s *dbxStmt) Upsert(vals interface{}, updateCols ...string) (int64, error) {
+	return s.engine.Upsert(s.table, vals, updateCols, s.sets, s.options()...)
 }
 
-func (s *dbxStmt) Iter(bean interface{}) (<-chan interface{}) {
+// vals is a bean whose non-zero fields are conditions too, or nil
+func (s *dbxStmt) Delete(vals interface{}) (int64, error) {
+	return s.engine.Delete(s.table, s.conds, vals, s.options()...)
+}
+
+func (s *dbxStmt) DeleteWhere() (int64, error) {
+	return s.engine.DeleteWhere(s.table, s.conds, s.options()...)
+}
+
+// stop releases the rows and returns the error, it must be called if the loop is stopped early.
+//  eg. ch, stop := db.XStmt("user").Iter(&user)
+//      defer stop()
+//      for u := range ch {
+//          if ... { break }
+//      }
+//      err := stop()
+func (s *dbxStmt) Iter(bean interface{}) (<-chan interface{}, func() error) {
+	return iter(s.Cursor(bean))
+}
+
+// bean is filled by Next() of the cursor, which must be closed
+func (s *dbxStmt) Cursor(bean interface{}) *Rows {
 	if stmt := s.generateJoinStmt(); stmt != nil {
-		return stmt.Iter(bean)
+		return stmt.Cursor(bean)
+	} else if len(s.selection) > 0 {
+		return s.engine.SelectStmt(s.table, []string{s.selection}, s.conds, s.options()...).Cursor(bean)
 	}
-	return s.engine.Iter(s.table, s.conds, bean, s.opts...)
+	return s.engine.Cursor(s.table, s.conds, bean, s.options()...)
 }
 
 func (s *dbxStmt) Iterate(bean interface{}, it FnIterate) error {
 	if stmt := s.generateJoinStmt(); stmt != nil {
 		return stmt.Iterate(bean, it)
 	}
-	return s.engine.Iterate(s.table, s.conds, bean, it, s.opts...)
+	return s.engine.Iterate(s.table, s.conds, bean, it, s.options()...)
+}
+
+// process the rows in batches of slices, with one query.
+//  eg. var users []User
+//      err := db.XStmt("user").Where(dbx.Gt("age", 10)).IterateBatches(&users, 100, func(batch interface{}) error {
+//          users := batch.([]User) // the slice is reused, it must not be kept
+//          ...
+//      })
+func (s *dbxStmt) IterateBatches(slicePtr interface{}, batchSize int, fn func(batch interface{}) error) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("bad batch size %d", batchSize)
+	}
+	bean, err := sliceElem(slicePtr)
+	if err != nil {
+		return err
+	}
+	return iterateBatches(s.Cursor(bean), slicePtr, batchSize, fn)
 }
 
 func (s *dbxStmt) Count(bean interface{}) (int64, error) {
 	if stmt := s.generateJoinStmt(); stmt != nil {
 		return stmt.Count(bean)
 	}
-	return s.engine.ListStmt(s.table, s.conds, s.opts...).Count(bean)
+	return s.engine.ListStmt(s.table, s.conds, s.options()...).Count(bean)
 }
 
 func (s *dbxStmt) Sum(bean interface{}, col string) (float64, error) {
 	if stmt := s.generateJoinStmt(); stmt != nil {
 		return stmt.Sum(bean, col)
 	}
-	return s.engine.ListStmt(s.table, s.conds, s.opts...).Sum(bean, col)
+	return s.engine.ListStmt(s.table, s.conds, s.options()...).Sum(bean, col)
+}
+
+// render the statement as a sub-query, columns are given by SelectCols() or Cols()
+func (s *dbxStmt) subquery() (string, []interface{}) {
+	opts := getOptions(s.opts...)
+	fields := opts.selection
+	if len(fields) == 0 && len(s.cols) > 0 {
+		fields = strings.Join(s.cols, ",")
+	}
+	sb := newSqlBuilder()
+	sb.appendSelect(fields, s.table, s.joinedElems, s.conds, opts.bys, opts.limit)
+	return sb.toSQL()
 }
 
 func (s *dbxStmt) generateJoinStmt() *joinStmt {
@@ -249,7 +388,7 @@ func (s *dbxStmt) generateJoinStmt() *joinStmt {
 		return nil
 	}
 	e0 := &s.joinedElems[0]
-	stmt := s.engine.joinStmt(s.table, e0.joinedTbl, e0.joinCond, e0.joinType, s.conds, s.opts...)
+	stmt := s.engine.joinStmt(s.table, e0.joinedTbl, e0.joinCond, e0.joinType, s.conds, s.options()...)
 	for i:=1; i<len(s.joinedElems); i++ {
 		e := &s.joinedElems[i]
 		stmt.join(e.joinedTbl, e.joinCond, e.joinType)
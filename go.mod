@@ -1,8 +1,9 @@
 module github.com/rosbit/dbx
 
-go 1.14
+go 1.15
 
 require (
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/rosbit/xorm v0.8.2
+	xorm.io/core v0.7.2-0.20190928055935-90aeac8d08eb
 )